@@ -0,0 +1,387 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golangnigeria/liveright_backend/internal/models"
+	"github.com/golangnigeria/liveright_backend/internal/repository"
+)
+
+// roleNamePattern restricts role names to lower-case words joined by
+// underscores, e.g. lab_technician.
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,49}$`)
+
+// AllRoles lists every role with the permissions it grants.
+func (app *application) AllRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := app.DB.AllRoles()
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, JSONResponse{
+		Message: "roles",
+		Data:    roles,
+	})
+}
+
+// CreateRole adds a new role. Permissions are attached separately.
+func (app *application) CreateRole(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Name string `json:"name"`
+	}
+
+	if err := app.readJSON(w, r, &payload); err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	name := strings.TrimSpace(payload.Name)
+	if !roleNamePattern.MatchString(name) {
+		_ = app.errorJSON(w, errors.New("role name must be 2-50 lower-case letters, digits or underscores"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	role, err := app.DB.InsertRole(name)
+	if err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			_ = app.errorJSON(w, errors.New("role already exists"), http.StatusConflict)
+			return
+		}
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.auditAdmin(r, models.AuditRoleCreated, map[string]any{"role_id": role.ID, "role": role.Name})
+
+	_ = app.writeJSON(w, http.StatusCreated, JSONResponse{
+		Message: "role created",
+		Data:    role,
+	})
+}
+
+// AllPermissions lists every permission that can be granted to a role.
+func (app *application) AllPermissions(w http.ResponseWriter, r *http.Request) {
+	permissions, err := app.DB.AllPermissions()
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, JSONResponse{
+		Message: "permissions",
+		Data:    permissions,
+	})
+}
+
+// AttachRolePermission grants a permission to a role. Callers can only
+// grant permissions their own role holds.
+func (app *application) AttachRolePermission(w http.ResponseWriter, r *http.Request) {
+	roleID, err := readIDParam(r, "roleID")
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	var payload struct {
+		Permission string `json:"permission"`
+	}
+
+	if err := app.readJSON(w, r, &payload); err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if _, err := app.DB.GetRoleByID(roleID); err != nil {
+		app.notFoundOrError(w, err, "role not found")
+		return
+	}
+
+	held, ok := app.callerPermissions(w, r)
+	if !ok {
+		return
+	}
+
+	// a role can only be given what the caller already holds, or anyone
+	// able to manage roles could grant their own role everything
+	if !slices.Contains(held, payload.Permission) {
+		_ = app.errorJSON(w, errors.New("you cannot grant a permission you do not hold"), http.StatusForbidden)
+		return
+	}
+
+	if err := app.DB.AttachPermissionToRole(roleID, payload.Permission); err != nil {
+		app.notFoundOrError(w, err, "permission not found")
+		return
+	}
+
+	app.auditAdmin(r, models.AuditRolePermissionsSet, map[string]any{"role_id": roleID, "attached": payload.Permission})
+
+	app.writeRolePermissions(w, roleID)
+}
+
+// DetachRolePermission removes a permission from a role.
+func (app *application) DetachRolePermission(w http.ResponseWriter, r *http.Request) {
+	roleID, err := readIDParam(r, "roleID")
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	permission := chi.URLParam(r, "permission")
+
+	if err := app.DB.DetachPermissionFromRole(roleID, permission); err != nil {
+		app.notFoundOrError(w, err, "role does not have this permission")
+		return
+	}
+
+	app.auditAdmin(r, models.AuditRolePermissionsSet, map[string]any{"role_id": roleID, "detached": permission})
+
+	app.writeRolePermissions(w, roleID)
+}
+
+func (app *application) writeRolePermissions(w http.ResponseWriter, roleID int64) {
+	permissions, err := app.DB.GetPermissionsForRole(roleID)
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, JSONResponse{
+		Message: "role permissions updated",
+		Data:    permissions,
+	})
+}
+
+// AssignUserRole changes the role of a user. The new role is reflected in
+// the user's access token the next time it is refreshed; permission checks
+// see it immediately. Callers cannot change their own role, nor assign or
+// replace a role granting permissions they do not hold.
+func (app *application) AssignUserRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := readIDParam(r, "userID")
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	var payload struct {
+		RoleID int64 `json:"role_id"`
+	}
+
+	if err := app.readJSON(w, r, &payload); err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	p, ok := principalFromContext(r.Context())
+	if !ok {
+		_ = app.errorJSON(w, errors.New("authorization required"), http.StatusUnauthorized)
+		return
+	}
+
+	if userID == p.ID {
+		_ = app.errorJSON(w, errors.New("you cannot change your own role"), http.StatusForbidden)
+		return
+	}
+
+	role, err := app.DB.GetRoleByID(payload.RoleID)
+	if err != nil {
+		app.notFoundOrError(w, err, "role not found")
+		return
+	}
+
+	target, err := app.DB.GetUserByID(userID)
+	if err != nil {
+		app.notFoundOrError(w, err, "user not found")
+		return
+	}
+
+	held, ok := app.callerPermissions(w, r)
+	if !ok {
+		return
+	}
+
+	// neither the new role nor the one it replaces may reach beyond the
+	// caller, so users:manage alone cannot hand out or take away admin
+	for _, roleID := range []int64{role.ID, target.RoleID.ID} {
+		outside, err := app.permissionOutside(roleID, held)
+		if err != nil {
+			_ = app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+		if outside != "" {
+			_ = app.errorJSON(w, fmt.Errorf("you cannot assign or replace a role with the %s permission, which you do not hold", outside), http.StatusForbidden)
+			return
+		}
+	}
+
+	if err := app.DB.UpdateUserRole(userID, role.ID); err != nil {
+		app.notFoundOrError(w, err, "user not found")
+		return
+	}
+
+	app.auditAdmin(r, models.AuditUserRoleAssigned, map[string]any{"target_user_id": userID, "role_id": role.ID, "role": role.Name})
+
+	_ = app.writeJSON(w, http.StatusOK, JSONResponse{
+		Message: "role assigned",
+		Data:    role,
+	})
+}
+
+// callerPermissions returns the names of the permissions the caller's role
+// grants. It writes an error response when it cannot.
+func (app *application) callerPermissions(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	user, ok := app.currentUser(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	permissions, err := app.DB.GetPermissionsForRole(user.RoleID.ID)
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return nil, false
+	}
+
+	names := make([]string, len(permissions))
+	for i, permission := range permissions {
+		names[i] = permission.Name
+	}
+
+	return names, true
+}
+
+// permissionOutside returns the first permission granted by roleID that
+// held does not include, or "" when there is none.
+func (app *application) permissionOutside(roleID int64, held []string) (string, error) {
+	permissions, err := app.DB.GetPermissionsForRole(roleID)
+	if err != nil {
+		return "", err
+	}
+
+	for _, permission := range permissions {
+		if !slices.Contains(held, permission.Name) {
+			return permission.Name, nil
+		}
+	}
+
+	return "", nil
+}
+
+// UnlockUser lifts a sign-in lockout and forgets the user's failed attempts.
+func (app *application) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := readIDParam(r, "userID")
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := app.DB.GetUserByID(userID)
+	if err != nil {
+		app.notFoundOrError(w, err, "user not found")
+		return
+	}
+
+	if err := app.DB.ClearLoginFailures(string(user.Email)); err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.auditAdmin(r, models.AuditAccountUnlocked, map[string]any{"target_user_id": user.ID})
+
+	_ = app.writeJSON(w, http.StatusOK, JSONResponse{
+		Message: "account unlocked",
+	})
+}
+
+// auditAdmin records an administrative action against the acting user.
+func (app *application) auditAdmin(r *http.Request, action string, metadata map[string]any) {
+	var userID *int64
+	if p, ok := principalFromContext(r.Context()); ok {
+		userID = &p.ID
+	}
+	app.audit(r, userID, action, metadata)
+}
+
+// notFoundOrError responds 404 with message when err is sql.ErrNoRows and
+// 500 otherwise.
+func (app *application) notFoundOrError(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = app.errorJSON(w, errors.New(message), http.StatusNotFound)
+		return
+	}
+	_ = app.errorJSON(w, err, http.StatusInternalServerError)
+}
+
+// ImpersonateUser issues a short-lived access token that lets an admin see
+// the platform as the given user. The token names the admin in its act
+// claim; high-risk actions refuse it and every request made with it is
+// audited.
+func (app *application) ImpersonateUser(w http.ResponseWriter, r *http.Request) {
+	p, ok := principalFromContext(r.Context())
+	if !ok {
+		_ = app.errorJSON(w, errors.New("authorization required"), http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := readIDParam(r, "userID")
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if userID == p.ID {
+		_ = app.errorJSON(w, errors.New("you cannot impersonate yourself"), http.StatusConflict)
+		return
+	}
+
+	user, err := app.DB.GetUserByID(userID)
+	if err != nil {
+		app.notFoundOrError(w, err, "user not found")
+		return
+	}
+
+	if !user.Active {
+		_ = app.errorJSON(w, errors.New("inactive users cannot be impersonated"), http.StatusConflict)
+		return
+	}
+
+	role, err := app.DB.GetRoleByID(user.RoleID.ID)
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if role.Name == models.RoleAdmin {
+		_ = app.errorJSON(w, errors.New("admins cannot be impersonated"), http.StatusForbidden)
+		return
+	}
+
+	token, expiresAt, err := app.auth.GenerateImpersonationToken(&jwtUser{
+		ID:            user.ID,
+		FirstName:     user.FirstName,
+		LastName:      user.LastName,
+		Role:          role.Name,
+		EmailVerified: user.EmailVerified(),
+	}, p.ID, p.Name)
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.auditAdmin(r, models.AuditImpersonationStart, map[string]any{"target_user_id": user.ID, "expires_at": expiresAt})
+
+	_ = app.writeJSON(w, http.StatusCreated, JSONResponse{
+		Message: "impersonating " + user.FirstName + " " + user.LastName,
+		Data: map[string]any{
+			"token":      token,
+			"expires_at": expiresAt,
+			"user":       newUserDTO(user, role.Name),
+		},
+	})
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/golangnigeria/liveright_backend/internal/models"
+)
+
+const (
+	patientRoleID = 1
+	adminRoleID   = 6
+	userAdminID   = 7
+	roleAdminID   = 8
+)
+
+// newRBACApp returns an application whose database holds a patient role,
+// an admin role with every permission, a role with only users:manage and
+// a role with only roles:manage, plus one user of each.
+func newRBACApp() (*application, *stubRepo) {
+	db := newStubRepo()
+	db.addRole(patientRoleID, models.RolePatient)
+	db.addRole(adminRoleID, models.RoleAdmin,
+		models.PermissionManageRoles, models.PermissionManageUsers,
+		models.PermissionManageOrganisations, models.PermissionReviewDoctors)
+	db.addRole(userAdminID, "user_admin", models.PermissionManageUsers)
+	db.addRole(roleAdminID, "role_admin", models.PermissionManageRoles)
+
+	db.addUser(1, patientRoleID)
+	db.addUser(2, adminRoleID)
+	db.addUser(3, userAdminID)
+	db.addUser(4, roleAdminID)
+
+	return &application{DB: db}, db
+}
+
+func TestAssignUserRole(t *testing.T) {
+	tests := []struct {
+		name     string
+		callerID int64
+		targetID int64
+		body     string
+		want     int
+		wantRole int64
+	}{
+		{"admin assigns admin", 2, 1, `{"role_id": 6}`, http.StatusOK, adminRoleID},
+		{"user manager assigns a narrower role", 3, 1, `{"role_id": 7}`, http.StatusOK, userAdminID},
+		{"user manager assigns admin", 3, 1, `{"role_id": 6}`, http.StatusForbidden, patientRoleID},
+		{"user manager demotes an admin", 3, 2, `{"role_id": 1}`, http.StatusForbidden, adminRoleID},
+		{"user manager changes own role", 3, 3, `{"role_id": 6}`, http.StatusForbidden, userAdminID},
+		{"admin changes own role", 2, 2, `{"role_id": 1}`, http.StatusForbidden, adminRoleID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, db := newRBACApp()
+
+			w := serve(t, app.AssignUserRole, &Principal{ID: tt.callerID}, tt.body, "userID", formatID(tt.targetID))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+
+			target, _ := db.GetUserByID(tt.targetID)
+			if target.RoleID.ID != tt.wantRole {
+				t.Errorf("target role = %d, want %d", target.RoleID.ID, tt.wantRole)
+			}
+		})
+	}
+}
+
+func TestAttachRolePermission(t *testing.T) {
+	tests := []struct {
+		name       string
+		callerID   int64
+		roleID     int64
+		permission string
+		want       int
+	}{
+		{"admin grants any permission", 2, 1, models.PermissionManageOrganisations, http.StatusOK},
+		{"role manager grants a permission it holds", 4, 1, models.PermissionManageRoles, http.StatusOK},
+		{"role manager grants users:manage", 4, 1, models.PermissionManageUsers, http.StatusForbidden},
+		{"role manager grants its own role more", 4, 8, models.PermissionManageUsers, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, db := newRBACApp()
+
+			w := serve(t, app.AttachRolePermission, &Principal{ID: tt.callerID}, `{"permission": "`+tt.permission+`"}`, "roleID", formatID(tt.roleID))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+
+			granted := slices.Contains(db.rolePermissions[tt.roleID], tt.permission)
+			if granted != (tt.want == http.StatusOK) {
+				t.Errorf("permission granted = %v after status %d", granted, w.Code)
+			}
+		})
+	}
+}
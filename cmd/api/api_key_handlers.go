@@ -0,0 +1,345 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golangnigeria/liveright_backend/internal/models"
+)
+
+const (
+	// apiKeyPrefix starts every API key so leaked keys are easy to spot,
+	// for example by secret scanners.
+	apiKeyPrefix = "lr_"
+
+	// apiKeyRotationGrace is how long a rotated-out key keeps working, so
+	// partners can deploy the new key without downtime.
+	apiKeyRotationGrace = time.Hour * 24
+)
+
+var errInvalidAPIKey = errors.New("invalid API key")
+
+// generateAPIKey returns a new key of the form lr_<prefix>_<secret>. The
+// prefix identifies the key in storage and in listings; the secret never
+// leaves this response.
+func generateAPIKey() (plain, prefix string, err error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	prefix = hex.EncodeToString(b)
+
+	secret, err := generateRandomToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	return apiKeyPrefix + prefix + "_" + secret, prefix, nil
+}
+
+// lookupAPIKey returns the stored key matching plain, provided it is still
+// valid.
+func (app *application) lookupAPIKey(plain string) (*models.APIKey, error) {
+	rest, ok := strings.CutPrefix(plain, apiKeyPrefix)
+	if !ok {
+		return nil, errInvalidAPIKey
+	}
+
+	prefix, _, ok := strings.Cut(rest, "_")
+	if !ok {
+		return nil, errInvalidAPIKey
+	}
+
+	key, err := app.DB.GetAPIKeyByPrefix(prefix)
+	if err != nil {
+		return nil, errInvalidAPIKey
+	}
+
+	if subtle.ConstantTimeCompare(hashToken(plain), key.KeyHash) != 1 || !key.Valid() {
+		return nil, errInvalidAPIKey
+	}
+
+	return key, nil
+}
+
+// apiKeyResponse is returned when a key is created or rotated; it is the
+// only time the full key is shown.
+type apiKeyResponse struct {
+	*models.APIKey
+	Key string `json:"key"`
+}
+
+// auditAPIKeyChange records a change to an API key made either by an admin
+// or by a partner using another API key.
+func (app *application) auditAPIKeyChange(r *http.Request, action string, metadata map[string]any) {
+	if c, ok := apiClientFromContext(r.Context()); ok {
+		metadata["by_api_key_id"] = c.KeyID
+		app.audit(r, nil, action, metadata)
+		return
+	}
+	app.auditAdmin(r, action, metadata)
+}
+
+// createAPIKey reads a name and scopes from the request and issues a key
+// for orgID. Scopes outside allowed are refused.
+func (app *application) createAPIKey(w http.ResponseWriter, r *http.Request, orgID int64, allowed []string) {
+	var payload struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	}
+
+	if err := app.readJSON(w, r, &payload); err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	name := strings.TrimSpace(payload.Name)
+	if name == "" || len(name) > 100 {
+		_ = app.errorJSON(w, errors.New("name must be 1-100 characters"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if len(payload.Scopes) == 0 {
+		_ = app.errorJSON(w, errors.New("at least one scope is required"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	scopes := slices.Compact(slices.Sorted(slices.Values(payload.Scopes)))
+	if scope, ok := scopeOutside(scopes, allowed); ok {
+		_ = app.errorJSON(w, errors.New("scope not allowed: "+scope), http.StatusUnprocessableEntity)
+		return
+	}
+
+	plain, prefix, err := generateAPIKey()
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	key := models.APIKey{
+		OrganisationID: orgID,
+		Name:           name,
+		Prefix:         prefix,
+		KeyHash:        hashToken(plain),
+		Scopes:         scopes,
+	}
+	if p, ok := principalFromContext(r.Context()); ok {
+		key.CreatedBy = &p.ID
+	}
+
+	if err := app.DB.InsertAPIKey(&key); err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.auditAPIKeyChange(r, models.AuditAPIKeyCreated, map[string]any{
+		"organisation_id": orgID,
+		"api_key_id":      key.ID,
+		"scopes":          key.Scopes,
+	})
+
+	_ = app.writeJSON(w, http.StatusCreated, JSONResponse{
+		Message: "API key created, store it now as it will not be shown again",
+		Data:    apiKeyResponse{APIKey: &key, Key: plain},
+	})
+}
+
+// scopeOutside returns the first of scopes that allowed does not include.
+func scopeOutside(scopes, allowed []string) (string, bool) {
+	for _, scope := range scopes {
+		if !slices.Contains(allowed, scope) {
+			return scope, true
+		}
+	}
+	return "", false
+}
+
+// loadManageableAPIKey loads one of orgID's keys named in the URL, refusing
+// keys holding scopes outside allowed so that a narrowly scoped caller
+// cannot take over or disable a broader key. It writes an error response
+// when it cannot.
+func (app *application) loadManageableAPIKey(w http.ResponseWriter, r *http.Request, orgID int64, allowed []string) (*models.APIKey, bool) {
+	keyID, err := readIDParam(r, "keyID")
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return nil, false
+	}
+
+	key, err := app.DB.GetAPIKey(orgID, keyID)
+	if err != nil {
+		app.notFoundOrError(w, err, "API key not found")
+		return nil, false
+	}
+
+	if scope, ok := scopeOutside(key.Scopes, allowed); ok {
+		_ = app.errorJSON(w, errors.New("API key holds a scope you do not have: "+scope), http.StatusForbidden)
+		return nil, false
+	}
+
+	return key, true
+}
+
+// listAPIKeys writes every key belonging to orgID.
+func (app *application) listAPIKeys(w http.ResponseWriter, orgID int64) {
+	keys, err := app.DB.GetAPIKeysForOrganisation(orgID)
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, JSONResponse{
+		Message: "API keys",
+		Data:    keys,
+	})
+}
+
+// rotateAPIKey replaces one of orgID's keys with a new key holding the same
+// name and scopes. The old key keeps working for apiKeyRotationGrace. Keys
+// with scopes outside allowed are refused.
+func (app *application) rotateAPIKey(w http.ResponseWriter, r *http.Request, orgID int64, allowed []string) {
+	old, ok := app.loadManageableAPIKey(w, r, orgID, allowed)
+	if !ok {
+		return
+	}
+
+	if !old.Valid() {
+		_ = app.errorJSON(w, errors.New("API key has already been revoked or has expired"), http.StatusConflict)
+		return
+	}
+
+	plain, prefix, err := generateAPIKey()
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	key := models.APIKey{
+		OrganisationID: orgID,
+		Name:           old.Name,
+		Prefix:         prefix,
+		KeyHash:        hashToken(plain),
+		Scopes:         old.Scopes,
+	}
+	if p, ok := principalFromContext(r.Context()); ok {
+		key.CreatedBy = &p.ID
+	}
+
+	oldExpiresAt := time.Now().Add(apiKeyRotationGrace)
+	if err := app.DB.RotateAPIKey(orgID, old.ID, oldExpiresAt, &key); err != nil {
+		app.notFoundOrError(w, err, "API key not found")
+		return
+	}
+
+	app.auditAPIKeyChange(r, models.AuditAPIKeyRotated, map[string]any{
+		"organisation_id": orgID,
+		"api_key_id":      key.ID,
+		"replaces":        old.ID,
+	})
+
+	_ = app.writeJSON(w, http.StatusCreated, JSONResponse{
+		Message: "API key rotated, the previous key stops working at " + oldExpiresAt.UTC().Format(time.RFC3339),
+		Data:    apiKeyResponse{APIKey: &key, Key: plain},
+	})
+}
+
+// revokeAPIKey stops one of orgID's keys from working immediately. Keys
+// with scopes outside allowed are refused.
+func (app *application) revokeAPIKey(w http.ResponseWriter, r *http.Request, orgID int64, allowed []string) {
+	key, ok := app.loadManageableAPIKey(w, r, orgID, allowed)
+	if !ok {
+		return
+	}
+
+	if err := app.DB.RevokeAPIKey(orgID, key.ID); err != nil {
+		app.notFoundOrError(w, err, "API key not found")
+		return
+	}
+
+	app.auditAPIKeyChange(r, models.AuditAPIKeyRevoked, map[string]any{
+		"organisation_id": orgID,
+		"api_key_id":      key.ID,
+	})
+
+	_ = app.writeJSON(w, http.StatusOK, JSONResponse{
+		Message: "API key revoked",
+	})
+}
+
+// readOrganisationParam loads the organisation named in the URL, writing a
+// 400 or 404 response when it cannot.
+func (app *application) readOrganisationParam(w http.ResponseWriter, r *http.Request) (*models.Organisation, bool) {
+	orgID, err := readIDParam(r, "orgID")
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return nil, false
+	}
+
+	org, err := app.DB.GetOrganisationByID(orgID)
+	if err != nil {
+		app.notFoundOrError(w, err, "organisation not found")
+		return nil, false
+	}
+
+	return org, true
+}
+
+// AdminListAPIKeys lists an organisation's API keys.
+func (app *application) AdminListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if org, ok := app.readOrganisationParam(w, r); ok {
+		app.listAPIKeys(w, org.ID)
+	}
+}
+
+// AdminCreateAPIKey issues an API key to an organisation with any scopes.
+func (app *application) AdminCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	if org, ok := app.readOrganisationParam(w, r); ok {
+		app.createAPIKey(w, r, org.ID, models.APIKeyScopes)
+	}
+}
+
+// AdminRotateAPIKey rotates one of an organisation's API keys.
+func (app *application) AdminRotateAPIKey(w http.ResponseWriter, r *http.Request) {
+	if org, ok := app.readOrganisationParam(w, r); ok {
+		app.rotateAPIKey(w, r, org.ID, models.APIKeyScopes)
+	}
+}
+
+// AdminRevokeAPIKey revokes one of an organisation's API keys.
+func (app *application) AdminRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	if org, ok := app.readOrganisationParam(w, r); ok {
+		app.revokeAPIKey(w, r, org.ID, models.APIKeyScopes)
+	}
+}
+
+// PartnerListAPIKeys lists the keys of the calling key's organisation.
+func (app *application) PartnerListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	c, _ := apiClientFromContext(r.Context())
+	app.listAPIKeys(w, c.OrganisationID)
+}
+
+// PartnerCreateAPIKey issues a key to the calling key's organisation. The
+// new key can only hold scopes the calling key already has.
+func (app *application) PartnerCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	c, _ := apiClientFromContext(r.Context())
+	app.createAPIKey(w, r, c.OrganisationID, c.Scopes)
+}
+
+// PartnerRotateAPIKey rotates one of the calling organisation's keys. Only
+// keys whose scopes the calling key also has can be rotated.
+func (app *application) PartnerRotateAPIKey(w http.ResponseWriter, r *http.Request) {
+	c, _ := apiClientFromContext(r.Context())
+	app.rotateAPIKey(w, r, c.OrganisationID, c.Scopes)
+}
+
+// PartnerRevokeAPIKey revokes one of the calling organisation's keys. Only
+// keys whose scopes the calling key also has can be revoked.
+func (app *application) PartnerRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	c, _ := apiClientFromContext(r.Context())
+	app.revokeAPIKey(w, r, c.OrganisationID, c.Scopes)
+}
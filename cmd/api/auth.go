@@ -1,6 +1,10 @@
 package main
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -11,7 +15,7 @@ import (
 type Auth struct {
 	Issuer        string
 	Audience      string
-	Secret        string
+	Keys          *KeySet
 	TokenExpiry   time.Duration
 	RefreshExpiry time.Duration
 	CookieDomain  string
@@ -20,68 +24,263 @@ type Auth struct {
 }
 
 type jwtUser struct {
-	ID        int64  `json:"id"`
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
-	Role      string `json:"role"`
+	ID            int64  `json:"id"`
+	FirstName     string `json:"first_name"`
+	LastName      string `json:"last_name"`
+	Role          string `json:"role"`
+	EmailVerified bool   `json:"email_verified"`
+	SessionID     string `json:"session_id"`
 }
 
 type TokenPairs struct {
 	Token        string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
+
+	// RefreshTokenID and RefreshExpiresAt describe the refresh token so it
+	// can be recorded server-side; they are never sent to the client.
+	RefreshTokenID   string    `json:"-"`
+	RefreshExpiresAt time.Time `json:"-"`
 }
 
 type Claims struct {
+	Name          string `json:"name,omitempty"`
+	Role          string `json:"role,omitempty"`
+	EmailVerified bool   `json:"email_verified,omitempty"`
+	SessionID     string `json:"sid,omitempty"`
+	Nonce         string `json:"nonce,omitempty"`
+	Actor         *Actor `json:"act,omitempty"`
+	Type          string `json:"typ"`
 	jwt.RegisteredClaims
 }
 
-func (j *Auth) GenerateTokenPair(user *jwtUser) (TokenPairs, error) {
-	// Create a token
-	token := jwt.New(jwt.SigningMethodHS256)
+// Actor is the act claim (RFC 8693) of an impersonation token. It names the
+// admin acting as the token's subject.
+type Actor struct {
+	Subject string `json:"sub"`
+	Name    string `json:"name,omitempty"`
+}
+
+const (
+	// accessTokenType is the typ claim carried by access tokens.
+	accessTokenType = "JWT"
+
+	// refreshTokenType marks refresh tokens so they cannot be mistaken for
+	// access tokens, which are signed with the same key.
+	refreshTokenType = "refresh"
+
+	// mfaChallengeType marks tokens handed out between the password and
+	// second-factor steps of sign-in.
+	mfaChallengeType = "mfa_challenge"
+
+	mfaChallengeExpiry = time.Minute * 5
+
+	// magicLinkType marks sign-in tokens sent by email.
+	magicLinkType = "magic_link"
+
+	magicLinkExpiry = time.Minute * 10
+
+	// impersonationExpiry is the lifetime of impersonation tokens, which
+	// cannot be refreshed.
+	impersonationExpiry = time.Minute * 10
+)
 
+func (j *Auth) GenerateTokenPair(user *jwtUser) (TokenPairs, error) {
 	// Set the Claims
-	claims := token.Claims.(jwt.MapClaims)
-	claims["name"] = fmt.Sprintf("%s%s", user.FirstName, user.LastName)
+	claims := jwt.MapClaims{}
+	claims["name"] = fmt.Sprintf("%s %s", user.FirstName, user.LastName)
 	claims["sub"] = fmt.Sprintf("%d", user.ID)
+	claims["role"] = user.Role
+	claims["email_verified"] = user.EmailVerified
+	claims["sid"] = user.SessionID
 	claims["aud"] = j.Audience
 	claims["iss"] = j.Issuer
 	claims["iat"] = time.Now().UTC().Unix()
-	claims["typ"] = "JWT"
+	claims["typ"] = accessTokenType
 
 	// Set the expiry for the JWT
 	claims["exp"] = time.Now().UTC().Add(j.TokenExpiry).Unix()
 
 	// Create a signed token
-	signedAccessToken, err := token.SignedString([]byte(j.Secret))
+	signedAccessToken, err := j.Keys.Sign(claims)
 	if err != nil {
 		return TokenPairs{}, err
 	}
 
 	// Create a Refresh token and set Claims
-	refreshToken := jwt.New(jwt.SigningMethodHS256)
-	refreshTokenClaims := refreshToken.Claims.(jwt.MapClaims)
+	refreshTokenID, err := generateRandomToken()
+	if err != nil {
+		return TokenPairs{}, err
+	}
+	refreshExpiresAt := time.Now().UTC().Add(j.RefreshExpiry)
+
+	refreshTokenClaims := jwt.MapClaims{}
+	refreshTokenClaims["iss"] = j.Issuer
 	refreshTokenClaims["sub"] = fmt.Sprintf("%d", user.ID)
+	refreshTokenClaims["jti"] = refreshTokenID
 	refreshTokenClaims["iat"] = time.Now().UTC().Unix()
+	refreshTokenClaims["typ"] = refreshTokenType
 
 	// Set the expiry for the refresh token
-	refreshTokenClaims["exp"] = time.Now().UTC().Add(j.RefreshExpiry).Unix()
+	refreshTokenClaims["exp"] = refreshExpiresAt.Unix()
 
 	// create signed refresh token
-	signedRefreshToken, err := refreshToken.SignedString([]byte(j.Secret))
+	signedRefreshToken, err := j.Keys.Sign(refreshTokenClaims)
 	if err != nil {
 		return TokenPairs{}, err
 	}
 
 	// Create tokenpairs and populate with signed token
 	tokenPair := TokenPairs{
-		Token:        signedAccessToken,
-		RefreshToken: signedRefreshToken,
+		Token:            signedAccessToken,
+		RefreshToken:     signedRefreshToken,
+		RefreshTokenID:   refreshTokenID,
+		RefreshExpiresAt: refreshExpiresAt,
 	}
 
 	// return token pairs
 	return tokenPair, nil
 }
 
+// GenerateImpersonationToken returns an access token for user carrying an
+// act claim that names the admin behind it. No refresh token is issued, so
+// the admin must start again once it expires.
+func (j *Auth) GenerateImpersonationToken(user *jwtUser, actorID int64, actorName string) (string, time.Time, error) {
+	now := time.Now().UTC()
+	expiresAt := now.Add(impersonationExpiry)
+
+	token, err := j.Keys.Sign(Claims{
+		Name:          fmt.Sprintf("%s %s", user.FirstName, user.LastName),
+		Role:          user.Role,
+		EmailVerified: user.EmailVerified,
+		Actor: &Actor{
+			Subject: fmt.Sprintf("%d", actorID),
+			Name:    actorName,
+		},
+		Type: accessTokenType,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    j.Issuer,
+			Subject:   fmt.Sprintf("%d", user.ID),
+			Audience:  jwt.ClaimStrings{j.Audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return token, expiresAt, nil
+}
+
+// ParseAccessToken verifies the signature, issuer, audience and expiry of an
+// access token and returns its claims.
+func (j *Auth) ParseAccessToken(accessToken string) (*Claims, error) {
+	return j.parseToken(accessToken, accessTokenType, jwt.WithAudience(j.Audience))
+}
+
+// ParseRefreshToken verifies the signature and expiry of a refresh token
+// and returns its claims.
+func (j *Auth) ParseRefreshToken(refreshToken string) (*Claims, error) {
+	claims, err := j.parseToken(refreshToken, refreshTokenType)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.ID == "" {
+		return nil, errors.New("refresh token has no id")
+	}
+
+	return claims, nil
+}
+
+// GenerateMFAChallenge returns a short-lived token proving that userID has
+// passed the password step of sign-in. It is exchanged, together with a
+// second factor, for a token pair. id is the single-use token ID recorded
+// server-side, so the challenge cannot be exchanged twice.
+func (j *Auth) GenerateMFAChallenge(userID int64, id string) (string, error) {
+	now := time.Now().UTC()
+
+	return j.Keys.Sign(Claims{
+		Type: mfaChallengeType,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    j.Issuer,
+			Subject:   fmt.Sprintf("%d", userID),
+			ID:        id,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(mfaChallengeExpiry)),
+		},
+	})
+}
+
+// ParseMFAChallenge verifies a token from GenerateMFAChallenge.
+func (j *Auth) ParseMFAChallenge(challenge string) (*Claims, error) {
+	claims, err := j.parseToken(challenge, mfaChallengeType)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.ID == "" {
+		return nil, errors.New("mfa token has no id")
+	}
+
+	return claims, nil
+}
+
+// GenerateMagicLink returns a sign-in token for userID to be emailed as a
+// link. id is the single-use token ID recorded server-side, and nonceHash
+// binds the link to the device that asked for it.
+func (j *Auth) GenerateMagicLink(userID int64, id, nonceHash string) (string, error) {
+	now := time.Now().UTC()
+
+	return j.Keys.Sign(Claims{
+		Nonce: nonceHash,
+		Type:  magicLinkType,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    j.Issuer,
+			Subject:   fmt.Sprintf("%d", userID),
+			ID:        id,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(magicLinkExpiry)),
+		},
+	})
+}
+
+// ParseMagicLink verifies a token from GenerateMagicLink.
+func (j *Auth) ParseMagicLink(link string) (*Claims, error) {
+	claims, err := j.parseToken(link, magicLinkType)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.ID == "" || claims.Nonce == "" {
+		return nil, errors.New("magic link token is incomplete")
+	}
+
+	return claims, nil
+}
+
+// parseToken verifies signature, issuer and expiry, then checks the typ
+// claim so that one kind of token can never be used as another.
+func (j *Auth) parseToken(tokenString, tokenType string, opts ...jwt.ParserOption) (*Claims, error) {
+	claims := &Claims{}
+
+	opts = append(opts,
+		jwt.WithValidMethods(j.Keys.ValidMethods()),
+		jwt.WithIssuer(j.Issuer),
+		jwt.WithExpirationRequired(),
+	)
+
+	if _, err := jwt.ParseWithClaims(tokenString, claims, j.Keys.Keyfunc, opts...); err != nil {
+		return nil, err
+	}
+
+	if claims.Type != tokenType {
+		return nil, fmt.Errorf("token is not a %s token", tokenType)
+	}
+
+	return claims, nil
+}
+
 func (j *Auth) GetRefreshToken(refreshToken string) *http.Cookie {
 	return &http.Cookie{
 		Name:     j.CookieName,
@@ -109,3 +308,52 @@ func (j *Auth) GetExpiredRefreshToken() *http.Cookie {
 		Secure:   true,
 	}
 }
+
+// magicLinkCookieName holds the device nonce for a pending magic link.
+const magicLinkCookieName = "__Host-magic_link_nonce"
+
+// GetMagicLinkCookie returns the cookie that binds a magic link to the
+// device that requested it.
+func (j *Auth) GetMagicLinkCookie(nonce string) *http.Cookie {
+	return &http.Cookie{
+		Name:     magicLinkCookieName,
+		Path:     "/",
+		Value:    nonce,
+		Expires:  time.Now().Add(magicLinkExpiry),
+		MaxAge:   int(magicLinkExpiry.Seconds()),
+		SameSite: http.SameSiteStrictMode,
+		HttpOnly: true,
+		Secure:   true,
+	}
+}
+
+// GetExpiredMagicLinkCookie returns a cookie that clears the magic link
+// nonce once it has been used.
+func (j *Auth) GetExpiredMagicLinkCookie() *http.Cookie {
+	return &http.Cookie{
+		Name:     magicLinkCookieName,
+		Path:     "/",
+		Value:    "",
+		Expires:  time.Unix(0, 0),
+		MaxAge:   -1,
+		SameSite: http.SameSiteStrictMode,
+		HttpOnly: true,
+		Secure:   true,
+	}
+}
+
+// generateRandomToken returns a URL-safe string built from 32 bytes of
+// cryptographically secure randomness.
+func generateRandomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the SHA-256 digest used to store tokens at rest.
+func hashToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+
+	"github.com/golangnigeria/liveright_backend/internal/models"
+)
+
+type contextKey string
+
+const principalContextKey contextKey = "principal"
+
+// Principal identifies the authenticated caller of a request.
+type Principal struct {
+	ID            int64  `json:"id"`
+	Name          string `json:"name"`
+	Role          string `json:"role"`
+	EmailVerified bool   `json:"email_verified"`
+	SessionID     string `json:"session_id"`
+
+	// ImpersonatorID is the admin acting as this user, or zero when the
+	// user is acting for themselves.
+	ImpersonatorID int64 `json:"impersonator_id,omitempty"`
+}
+
+// Impersonated reports whether an admin is acting as the user.
+func (p *Principal) Impersonated() bool {
+	return p.ImpersonatorID != 0
+}
+
+// contextWithPrincipal returns a copy of ctx carrying p.
+func contextWithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey, p)
+}
+
+// principalFromContext returns the principal stored by RequireAuth. The
+// boolean is false when the request was not authenticated.
+func principalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalContextKey).(*Principal)
+	return p, ok && p != nil
+}
+
+const apiClientContextKey contextKey = "api_client"
+
+// APIClient identifies a partner system calling with an API key.
+type APIClient struct {
+	KeyID          int64    `json:"key_id"`
+	OrganisationID int64    `json:"organisation_id"`
+	Scopes         []string `json:"scopes"`
+}
+
+// contextWithAPIClient returns a copy of ctx carrying c.
+func contextWithAPIClient(ctx context.Context, c *APIClient) context.Context {
+	return context.WithValue(ctx, apiClientContextKey, c)
+}
+
+// apiClientFromContext returns the API client stored by RequireAPIKey. The
+// boolean is false when the request did not use an API key.
+func apiClientFromContext(ctx context.Context) (*APIClient, bool) {
+	c, ok := ctx.Value(apiClientContextKey).(*APIClient)
+	return c, ok && c != nil
+}
+
+const membershipContextKey contextKey = "membership"
+
+// contextWithMembership returns a copy of ctx carrying the caller's
+// organisation membership.
+func contextWithMembership(ctx context.Context, m *models.OrganisationMember) context.Context {
+	return context.WithValue(ctx, membershipContextKey, m)
+}
+
+// membershipFromContext returns the membership stored by
+// RequireOrganisationMember. The boolean is false outside organisation
+// routes.
+func membershipFromContext(ctx context.Context) (*models.OrganisationMember, bool) {
+	m, ok := ctx.Value(membershipContextKey).(*models.OrganisationMember)
+	return m, ok && m != nil
+}
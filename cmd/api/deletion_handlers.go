@@ -0,0 +1,195 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/golangnigeria/liveright_backend/internal/mailer"
+	"github.com/golangnigeria/liveright_backend/internal/models"
+	"github.com/golangnigeria/liveright_backend/internal/repository"
+)
+
+// deletionBatchSize caps how many accounts one run of the deletion job
+// anonymises; the rest wait for the next run.
+const deletionBatchSize = 100
+
+// Data touched when an account is anonymised, listed on its deletion
+// certificate.
+var (
+	deletionAnonymised = []string{"name", "email address", "phone number", "password", "doctor profile", "audit log network details"}
+	deletionErased     = []string{"sessions", "one-time tokens", "two-factor secrets and recovery codes", "pending email changes", "sign-in codes", "sign-in link requests", "organisation membership", "sign-in failures", "data exports"}
+	deletionRetained   = []string{"wallet transactions", "insurance claims", "audit log"}
+)
+
+// RequestAccountDeletion schedules the authenticated user's account for
+// deletion once the grace period has passed. Until then the user can sign
+// in as usual and cancel the request.
+func (app *application) RequestAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Password string `json:"password"`
+	}
+
+	if err := app.readJSON(w, r, &payload); err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, ok := app.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.confirmPassword(w, r, user, payload.Password) {
+		return
+	}
+
+	deletion := &models.AccountDeletion{
+		UserID:       user.ID,
+		ScheduledFor: time.Now().Add(app.deletionGracePeriod),
+	}
+
+	if err := app.DB.InsertAccountDeletion(deletion); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			_ = app.errorJSON(w, errors.New("account deletion already requested"), http.StatusConflict)
+			return
+		}
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.audit(r, &user.ID, models.AuditDeletionRequested, map[string]any{"deletion_id": deletion.ID, "scheduled_for": deletion.ScheduledFor})
+
+	app.sendEmail(mailer.Message{
+		To:      string(user.Email),
+		Subject: "Your LiveRight account will be deleted",
+		Body: fmt.Sprintf(
+			"Hello %s,\n\nWe received a request to delete your LiveRight account. It will be deleted on %s. Until then you can sign in and cancel the request from your account settings.\n\nPayment and insurance claim records that we must keep by law are retained, but they will no longer be linked to your name or contact details.",
+			user.FirstName, deletion.ScheduledFor.Format("2 January 2006"),
+		),
+	})
+
+	_ = app.writeJSON(w, http.StatusAccepted, JSONResponse{
+		Message: "account deletion scheduled",
+		Data:    deletion,
+	})
+}
+
+// GetAccountDeletion returns the authenticated user's pending deletion
+// request.
+func (app *application) GetAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	p, ok := principalFromContext(r.Context())
+	if !ok {
+		_ = app.errorJSON(w, errors.New("authorization required"), http.StatusUnauthorized)
+		return
+	}
+
+	deletion, err := app.DB.GetPendingAccountDeletion(p.ID)
+	if err != nil {
+		app.notFoundOrError(w, err, "no account deletion pending")
+		return
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, JSONResponse{
+		Message: "account deletion pending",
+		Data:    deletion,
+	})
+}
+
+// CancelAccountDeletion withdraws the authenticated user's pending deletion
+// request.
+func (app *application) CancelAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.DB.CancelAccountDeletion(user.ID); err != nil {
+		app.notFoundOrError(w, err, "no account deletion pending")
+		return
+	}
+
+	app.audit(r, &user.ID, models.AuditDeletionCancelled, nil)
+
+	app.sendEmail(mailer.Message{
+		To:      string(user.Email),
+		Subject: "Your LiveRight account will not be deleted",
+		Body: fmt.Sprintf(
+			"Hello %s,\n\nThe request to delete your LiveRight account has been cancelled. If this was not you, change your password straight away.",
+			user.FirstName,
+		),
+	})
+
+	_ = app.writeJSON(w, http.StatusOK, JSONResponse{
+		Message: "account deletion cancelled",
+	})
+}
+
+// processAccountDeletions anonymises the accounts whose deletion grace
+// period has ended. It runs in the background, so failures are logged and
+// retried on the next run.
+func (app *application) processAccountDeletions() {
+	deletions, err := app.DB.GetDueAccountDeletions(deletionBatchSize)
+	if err != nil {
+		log.Println("account deletion: unable to list due deletions:", err)
+		return
+	}
+
+	for _, deletion := range deletions {
+		if err := app.anonymiseAccount(deletion); err != nil {
+			log.Printf("account deletion: unable to delete account %d: %v", deletion.UserID, err)
+		}
+	}
+}
+
+// anonymiseAccount carries out one deletion request, records its
+// certificate in the audit log and lets the user know at the address they
+// had.
+func (app *application) anonymiseAccount(deletion *models.AccountDeletion) error {
+	user, err := app.DB.GetUserByID(deletion.UserID)
+	if err != nil {
+		return err
+	}
+
+	certificateID, err := generateRandomToken()
+	if err != nil {
+		return err
+	}
+	deletion.CertificateID = &certificateID
+
+	certificate := &models.AuditEntry{
+		UserID: &deletion.UserID,
+		Action: models.AuditAccountDeleted,
+		Metadata: map[string]any{
+			"certificate_id": certificateID,
+			"deletion_id":    deletion.ID,
+			"requested_at":   deletion.RequestedAt,
+			"scheduled_for":  deletion.ScheduledFor,
+			"anonymised":     deletionAnonymised,
+			"erased":         deletionErased,
+			"retained":       deletionRetained,
+		},
+	}
+
+	if err := app.DB.AnonymiseUser(deletion, certificate); err != nil {
+		// cancelled since it was listed
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	app.sendEmail(mailer.Message{
+		To:      string(user.Email),
+		Subject: "Your LiveRight account has been deleted",
+		Body: fmt.Sprintf(
+			"Hello %s,\n\nYour LiveRight account has been deleted as you requested. Records we must keep by law are retained without your name or contact details.\n\nYour deletion certificate reference is %s.",
+			user.FirstName, certificateID,
+		),
+	})
+
+	return nil
+}
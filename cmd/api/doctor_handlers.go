@@ -0,0 +1,234 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/golangnigeria/liveright_backend/internal/mailer"
+	"github.com/golangnigeria/liveright_backend/internal/models"
+)
+
+// licenceNumberPattern matches MDCN registration numbers after
+// normalisation, e.g. MDCN/R/12345 or 12345.
+var licenceNumberPattern = regexp.MustCompile(`^[A-Z0-9][A-Z0-9/-]{2,29}$`)
+
+// normalizeLicenceNumber upper-cases a licence number and drops spaces so
+// the same licence cannot be registered twice in different forms.
+func normalizeLicenceNumber(licence string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(licence), ""))
+}
+
+// RegisterDoctor creates a doctor account awaiting admin approval. The
+// account can verify its email straight away but cannot sign in until an
+// admin has checked the licence number.
+func (app *application) RegisterDoctor(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		FirstName         string `json:"first_name"`
+		LastName          string `json:"last_name"`
+		Email             string `json:"email"`
+		Password          string `json:"password"`
+		Phone             string `json:"phone,omitempty"`
+		Specialization    string `json:"specialization"`
+		YearsOfExperience int    `json:"years_of_experience"`
+		Bio               string `json:"bio,omitempty"`
+		LicenceNumber     string `json:"licence_number"`
+	}
+
+	if err := app.readJSON(w, r, &payload); err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	doctor := &models.Doctor{
+		Specialization:    strings.TrimSpace(payload.Specialization),
+		YearsOfExperience: payload.YearsOfExperience,
+		Bio:               strings.TrimSpace(payload.Bio),
+		LicenceNumber:     normalizeLicenceNumber(payload.LicenceNumber),
+	}
+
+	switch {
+	case doctor.Specialization == "" || len(doctor.Specialization) > 100:
+		_ = app.errorJSON(w, errors.New("specialization must be 1-100 characters"), http.StatusUnprocessableEntity)
+		return
+	case doctor.YearsOfExperience < 0 || doctor.YearsOfExperience > 70:
+		_ = app.errorJSON(w, errors.New("years of experience must be between 0 and 70"), http.StatusUnprocessableEntity)
+		return
+	case len(doctor.Bio) > 2000:
+		_ = app.errorJSON(w, errors.New("bio must be at most 2000 characters"), http.StatusUnprocessableEntity)
+		return
+	case !licenceNumberPattern.MatchString(doctor.LicenceNumber):
+		_ = app.errorJSON(w, errors.New("licence number must be a valid MDCN registration number"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	// The MDCN register is public, so saying a licence is taken reveals
+	// nothing new, and a doctor whose number was used by someone else needs
+	// to know to contact support.
+	registered, err := app.DB.LicenceNumberRegistered(doctor.LicenceNumber)
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	if registered {
+		_ = app.errorJSON(w, errors.New("an application with this licence number already exists, please contact support"), http.StatusConflict)
+		return
+	}
+
+	userPhone, ok := app.normalizePhone(w, payload.Phone)
+	if !ok {
+		return
+	}
+
+	u := &models.User{
+		FirstName: payload.FirstName,
+		LastName:  payload.LastName,
+		Email:     models.Email(payload.Email),
+		Phone:     userPhone,
+		Active:    true,
+		RoleID:    models.Role{ID: 2}, // doctor
+	}
+
+	app.registerUser(w, payload.Password, u, func(u *models.User) (*models.User, error) {
+		return app.DB.InsertDoctor(u, doctor)
+	})
+}
+
+// checkDoctorApproved refuses sign-in to doctors whose application has not
+// been approved. It writes a 403 response and returns false when sign-in
+// must stop; users with other roles always pass.
+func (app *application) checkDoctorApproved(w http.ResponseWriter, user *models.User) bool {
+	role, err := app.DB.GetRoleByID(user.RoleID.ID)
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return false
+	}
+
+	if role.Name != models.RoleDoctor {
+		return true
+	}
+
+	doctor, err := app.DB.GetDoctor(user.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return false
+	}
+
+	switch {
+	case doctor != nil && doctor.Approved():
+		return true
+	case doctor != nil && doctor.Status == models.DoctorStatusPending:
+		_ = app.errorJSON(w, errors.New("your doctor application is awaiting review"), http.StatusForbidden)
+	default:
+		_ = app.errorJSON(w, errors.New("your doctor application was not approved, please contact support"), http.StatusForbidden)
+	}
+	return false
+}
+
+// DoctorApplications lists doctors by review state, pending by default.
+func (app *application) DoctorApplications(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = models.DoctorStatusPending
+	}
+
+	statuses := []string{models.DoctorStatusPending, models.DoctorStatusApproved, models.DoctorStatusRejected}
+	if !slices.Contains(statuses, status) {
+		_ = app.errorJSON(w, errors.New("status must be one of "+strings.Join(statuses, ", ")), http.StatusBadRequest)
+		return
+	}
+
+	doctors, err := app.DB.GetDoctorsByStatus(status)
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, JSONResponse{
+		Message: "doctor applications",
+		Data:    doctors,
+	})
+}
+
+// ApproveDoctor approves a pending doctor application.
+func (app *application) ApproveDoctor(w http.ResponseWriter, r *http.Request) {
+	app.reviewDoctor(w, r, models.DoctorStatusApproved, nil)
+}
+
+// RejectDoctor rejects a pending doctor application with a reason that is
+// passed on to the applicant.
+func (app *application) RejectDoctor(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Reason string `json:"reason"`
+	}
+
+	if err := app.readJSON(w, r, &payload); err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	reason := strings.TrimSpace(payload.Reason)
+	if reason == "" || len(reason) > 1000 {
+		_ = app.errorJSON(w, errors.New("reason must be 1-1000 characters"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	app.reviewDoctor(w, r, models.DoctorStatusRejected, &reason)
+}
+
+// reviewDoctor records the decision on the application named in the URL,
+// audits it and tells the applicant by email.
+func (app *application) reviewDoctor(w http.ResponseWriter, r *http.Request, status string, reason *string) {
+	userID, err := readIDParam(r, "userID")
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	p, ok := principalFromContext(r.Context())
+	if !ok {
+		_ = app.errorJSON(w, errors.New("authorization required"), http.StatusUnauthorized)
+		return
+	}
+
+	if err := app.DB.ReviewDoctor(userID, status, reason, p.ID); err != nil {
+		app.notFoundOrError(w, err, "no pending application for this user")
+		return
+	}
+
+	doctor, err := app.DB.GetDoctor(userID)
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	action, body := models.AuditDoctorApproved, fmt.Sprintf(
+		"Hello %s,\n\nYour application to practise on LiveRight has been approved. You can now sign in as a doctor.",
+		doctor.FirstName,
+	)
+	metadata := map[string]any{"target_user_id": userID, "licence_number": doctor.LicenceNumber}
+	if reason != nil {
+		action, body = models.AuditDoctorRejected, fmt.Sprintf(
+			"Hello %s,\n\nWe were unable to approve your application to practise on LiveRight, for the following reason:\n\n%s\n\nPlease contact support if you believe this is a mistake.",
+			doctor.FirstName, *reason,
+		)
+		metadata["reason"] = *reason
+	}
+
+	app.auditAdmin(r, action, metadata)
+
+	app.sendEmail(mailer.Message{
+		To:      doctor.Email,
+		Subject: "Your LiveRight doctor application",
+		Body:    body,
+	})
+
+	_ = app.writeJSON(w, http.StatusOK, JSONResponse{
+		Message: "doctor application " + status,
+		Data:    doctor,
+	})
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golangnigeria/liveright_backend/internal/mailer"
+	"github.com/golangnigeria/liveright_backend/internal/models"
+)
+
+const emailVerificationTTL = time.Hour * 24
+
+// sendVerificationEmail issues a verification token for user and emails it.
+func (app *application) sendVerificationEmail(user *models.User) error {
+	token, err := app.issueUserToken(user.ID, models.TokenPurposeEmailVerification, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	app.sendEmail(mailer.Message{
+		To:      string(user.Email),
+		Subject: "Confirm your LiveRight email address",
+		Body: fmt.Sprintf(
+			"Hello %s,\n\nPlease confirm your email address by opening the link below. It expires in %d hours.\n\n%s\n\nIf you did not create a LiveRight account, you can ignore this email.",
+			user.FirstName, int(emailVerificationTTL.Hours()), app.frontendLink("/verify-email", token),
+		),
+	})
+
+	return nil
+}
+
+// sendExistingAccountEmail tells the owner of an address that someone tried
+// to register it again, instead of revealing that to the registrant.
+func (app *application) sendExistingAccountEmail(user *models.User) {
+	app.sendEmail(mailer.Message{
+		To:      string(user.Email),
+		Subject: "You already have a LiveRight account",
+		Body: fmt.Sprintf(
+			"Hello %s,\n\nSomeone tried to create a LiveRight account with this email address, but you already have one. If that was you, sign in or reset your password here:\n\n%s\n\nIf it was not you, you can ignore this email.",
+			user.FirstName, strings.TrimRight(app.FrontendURL, "/")+"/forgot-password",
+		),
+	})
+}
+
+// VerifyEmail confirms a user's email address using the token from the
+// verification email.
+func (app *application) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	plain := r.URL.Query().Get("token")
+	if plain == "" {
+		_ = app.errorJSON(w, errors.New("token is required"), http.StatusBadRequest)
+		return
+	}
+
+	token, err := app.DB.ConsumeUserToken(hashToken(plain), models.TokenPurposeEmailVerification)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			_ = app.errorJSON(w, errors.New("invalid or expired verification token"), http.StatusBadRequest)
+			return
+		}
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.DB.SetEmailVerified(token.UserID); err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.audit(r, &token.UserID, models.AuditEmailVerified, nil)
+
+	_ = app.writeJSON(w, http.StatusOK, JSONResponse{
+		Message: "email address verified, you can now sign in",
+	})
+}
+
+// ResendVerificationEmail sends a fresh verification link to the
+// authenticated user, invalidating any earlier one.
+func (app *application) ResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	p, ok := principalFromContext(r.Context())
+	if !ok {
+		_ = app.errorJSON(w, errors.New("authorization required"), http.StatusUnauthorized)
+		return
+	}
+
+	user, err := app.DB.GetUserByID(p.ID)
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if user.EmailVerified() {
+		_ = app.errorJSON(w, errors.New("email address is already verified"), http.StatusConflict)
+		return
+	}
+
+	if err := app.sendVerificationEmail(user); err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	_ = app.writeJSON(w, http.StatusAccepted, JSONResponse{
+		Message: "verification email sent",
+	})
+}
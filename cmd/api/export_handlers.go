@@ -0,0 +1,313 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golangnigeria/liveright_backend/internal/mailer"
+	"github.com/golangnigeria/liveright_backend/internal/models"
+	"github.com/golangnigeria/liveright_backend/internal/repository"
+)
+
+const (
+	// dataExportRetention is how long a prepared archive is kept.
+	dataExportRetention = time.Hour * 24 * 7
+
+	// dataExportLinkTTL is how long a download link works.
+	dataExportLinkTTL = time.Minute * 15
+
+	// dataExportBatchSize caps how many exports one run of the export job
+	// prepares; the rest wait for the next run.
+	dataExportBatchSize = 20
+)
+
+// exportSection is one JSON file in a data export. collect returns nil when
+// the user has nothing to put in it, in which case the file is left out.
+type exportSection struct {
+	name    string
+	collect func(app *application, user *models.User) (any, error)
+}
+
+// exportSections lists the files in a data export. Appointments, lab tests,
+// wallet transactions and insurance claims are added here as their tables
+// are created.
+var exportSections = []exportSection{
+	{"profile.json", func(app *application, user *models.User) (any, error) {
+		return app.userDTO(user)
+	}},
+	{"doctor_profile.json", func(app *application, user *models.User) (any, error) {
+		return optional(app.DB.GetDoctor(user.ID))
+	}},
+	{"organisation_membership.json", func(app *application, user *models.User) (any, error) {
+		return optional(app.DB.GetOrganisationMembership(user.ID))
+	}},
+	{"sessions.json", func(app *application, user *models.User) (any, error) {
+		return list(app.DB.GetSessionsForUser(user.ID))
+	}},
+	{"audit_log.json", func(app *application, user *models.User) (any, error) {
+		entries, err := app.DB.GetAuditEntriesForUser(user.ID)
+		return list(ownAuditEntries(entries), err)
+	}},
+}
+
+// exportedAuditActions are the audit log actions that describe the user's
+// own account. Entries the user recorded while acting on others, as an
+// admin, organisation admin or impersonator, are about those people and are
+// left out of the export.
+var exportedAuditActions = map[string]bool{
+	models.AuditRefreshTokenReuse:   true,
+	models.AuditPasswordReset:       true,
+	models.AuditPasswordChanged:     true,
+	models.AuditEmailVerified:       true,
+	models.AuditAccountLocked:       true,
+	models.AuditMFAEnabled:          true,
+	models.AuditMFADisabled:         true,
+	models.AuditRecoveryCodeUsed:    true,
+	models.AuditMemberJoined:        true,
+	models.AuditEmailChanged:        true,
+	models.AuditPhoneChanged:        true,
+	models.AuditPhoneRemoved:        true,
+	models.AuditDeletionRequested:   true,
+	models.AuditDeletionCancelled:   true,
+	models.AuditDataExportRequested: true,
+	models.AuditDataExportDownload:  true,
+}
+
+// ownAuditEntries keeps the entries whose action is in exportedAuditActions.
+func ownAuditEntries(entries []*models.AuditEntry) []*models.AuditEntry {
+	var own []*models.AuditEntry
+	for _, entry := range entries {
+		if exportedAuditActions[entry.Action] {
+			own = append(own, entry)
+		}
+	}
+	return own
+}
+
+// optional turns sql.ErrNoRows into an absent value.
+func optional[T any](v *T, err error) (any, error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// list makes an empty result an empty JSON array rather than null.
+func list[T any](v []T, err error) (any, error) {
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		v = []T{}
+	}
+	return v, nil
+}
+
+// RequestDataExport queues a copy of the authenticated user's personal
+// data. It is prepared in the background and the user is emailed when it
+// is ready.
+func (app *application) RequestDataExport(w http.ResponseWriter, r *http.Request) {
+	p, ok := principalFromContext(r.Context())
+	if !ok {
+		_ = app.errorJSON(w, errors.New("authorization required"), http.StatusUnauthorized)
+		return
+	}
+
+	export := &models.DataExport{UserID: p.ID}
+
+	if err := app.DB.InsertDataExport(export); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			_ = app.errorJSON(w, errors.New("a data export is already being prepared"), http.StatusConflict)
+			return
+		}
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.audit(r, &p.ID, models.AuditDataExportRequested, map[string]any{"export_id": export.ID})
+
+	_ = app.writeJSON(w, http.StatusAccepted, JSONResponse{
+		Message: "data export requested",
+		Data:    export,
+	})
+}
+
+// GetDataExport reports the state of one of the authenticated user's data
+// exports. Once it is ready the response carries a fresh download link,
+// which stops working after a few minutes or when another is issued.
+func (app *application) GetDataExport(w http.ResponseWriter, r *http.Request) {
+	p, ok := principalFromContext(r.Context())
+	if !ok {
+		_ = app.errorJSON(w, errors.New("authorization required"), http.StatusUnauthorized)
+		return
+	}
+
+	id, err := readIDParam(r, "exportID")
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	export, err := app.DB.GetDataExport(p.ID, id)
+	if err != nil {
+		app.notFoundOrError(w, err, "data export not found")
+		return
+	}
+
+	if export.Status != models.DataExportReady {
+		_ = app.writeJSON(w, http.StatusOK, JSONResponse{
+			Message: "data export " + export.Status,
+			Data:    export,
+		})
+		return
+	}
+
+	token, err := generateRandomToken()
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	expiresAt := time.Now().Add(dataExportLinkTTL)
+
+	if err := app.DB.SetDataExportDownloadToken(export.ID, hashToken(token), expiresAt); err != nil {
+		// expired since it was read
+		app.notFoundOrError(w, err, "data export has expired")
+		return
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, JSONResponse{
+		Message: "data export ready",
+		Data: map[string]any{
+			"export":              export,
+			"download_url":        app.apiLink("/exports/download", token),
+			"download_expires_at": expiresAt,
+		},
+	})
+}
+
+// DownloadDataExport serves the archive behind a download link. The link's
+// token is the only credential, so the link can be opened directly in a
+// browser.
+func (app *application) DownloadDataExport(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		_ = app.errorJSON(w, errors.New("token is required"), http.StatusBadRequest)
+		return
+	}
+
+	export, err := app.DB.GetDataExportByDownloadToken(hashToken(token))
+	if err != nil {
+		app.notFoundOrError(w, err, "download link is invalid or has expired")
+		return
+	}
+
+	app.audit(r, &export.UserID, models.AuditDataExportDownload, map[string]any{"export_id": export.ID})
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="liveright-data-%d.zip"`, export.ID))
+	w.Header().Set("Content-Length", strconv.Itoa(len(export.Archive)))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(export.Archive)
+}
+
+// processDataExports prepares queued data exports and discards expired
+// ones. It runs in the background, so failures are logged; an export that
+// cannot be prepared is marked failed so the user can ask again.
+func (app *application) processDataExports() {
+	if err := app.DB.ExpireDataExports(); err != nil {
+		log.Println("data export: unable to expire old exports:", err)
+	}
+
+	exports, err := app.DB.GetPendingDataExports(dataExportBatchSize)
+	if err != nil {
+		log.Println("data export: unable to list pending exports:", err)
+		return
+	}
+
+	for _, export := range exports {
+		if err := app.prepareDataExport(export); err != nil {
+			log.Printf("data export: unable to prepare export %d: %v", export.ID, err)
+			if err := app.DB.FailDataExport(export.ID); err != nil {
+				log.Printf("data export: unable to mark export %d failed: %v", export.ID, err)
+			}
+		}
+	}
+}
+
+// prepareDataExport builds and stores the archive for one export, then
+// lets the user know it is ready.
+func (app *application) prepareDataExport(export *models.DataExport) error {
+	user, err := app.DB.GetUserByID(export.UserID)
+	if err != nil {
+		return err
+	}
+
+	archive, err := app.buildDataExport(user)
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(dataExportRetention)
+
+	if err := app.DB.CompleteDataExport(export.ID, archive, expiresAt); err != nil {
+		return err
+	}
+
+	app.sendEmail(mailer.Message{
+		To:      string(user.Email),
+		Subject: "Your LiveRight data export is ready",
+		Body: fmt.Sprintf(
+			"Hello %s,\n\nThe copy of your data you asked for is ready. Sign in and open your account settings to download it. It will be available until %s.",
+			user.FirstName, expiresAt.Format("2 January 2006"),
+		),
+	})
+
+	return nil
+}
+
+// buildDataExport collects every export section for user into a zip
+// archive of JSON files.
+func (app *application) buildDataExport(user *models.User) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	for _, section := range exportSections {
+		data, err := section.collect(app, user)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", section.name, err)
+		}
+		if data == nil {
+			continue
+		}
+
+		f, err := zw.Create(section.name)
+		if err != nil {
+			return nil, err
+		}
+
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", section.name, err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
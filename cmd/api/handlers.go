@@ -1,11 +1,15 @@
 package main
 
 import (
+	"database/sql"
 	"errors"
 	"log"
 	"net/http"
+	"strings"
 
 	"github.com/golangnigeria/liveright_backend/internal/models"
+	"github.com/golangnigeria/liveright_backend/internal/phone"
+	"github.com/golangnigeria/liveright_backend/internal/repository"
 )
 
 func (app *application) Home(w http.ResponseWriter, r *http.Request) {
@@ -22,6 +26,21 @@ func (app *application) Home(w http.ResponseWriter, r *http.Request) {
 	_ = app.writeJSON(w, http.StatusOK, payload)
 }
 
+// JWKS publishes the public keys that verify our tokens so partner services
+// can check them without sharing a secret.
+func (app *application) JWKS(w http.ResponseWriter, r *http.Request) {
+	headers := http.Header{}
+	headers.Set("Cache-Control", "public, max-age=300")
+
+	_ = app.writeJSON(w, http.StatusOK, map[string]any{
+		"keys": app.auth.Keys.JWKS(),
+	}, headers)
+}
+
+// errInvalidCredentials is the only error a failed sign-in reports, so the
+// response never reveals whether the email is registered.
+var errInvalidCredentials = errors.New("invalid email or password")
+
 func (app *application) Authenticate(w http.ResponseWriter, r *http.Request) {
 	// read json payload
 	var requestPayload struct {
@@ -35,48 +54,147 @@ func (app *application) Authenticate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// refuse throttled or locked accounts before doing any password work
+	attempt, ok := app.reserveLoginAttempt(w, r, requestPayload.Email)
+	if !ok {
+		return
+	}
+
 	// validate against the database
 	userEmail, err := app.DB.GetUserByEmail(requestPayload.Email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// Check password. Unknown emails are compared against a dummy hash so
+	// the response takes as long as it does for a registered one.
+	var valid, needsRehash bool
+	var userID *int64
+	if userEmail != nil {
+		userID = &userEmail.ID
+		valid, needsRehash, err = userEmail.PasswordMatches(requestPayload.Password, app.hashParams)
+		valid = valid && err == nil && userEmail.Active
+	} else {
+		_, _, _ = app.dummyPasswords.forEmail(requestPayload.Email).PasswordMatches(requestPayload.Password, app.hashParams)
+	}
+
+	if !valid {
+		if err := app.recordLoginFailure(r, requestPayload.Email, userID); err != nil {
+			_ = app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+		_ = app.errorJSON(w, errInvalidCredentials, http.StatusUnauthorized)
+		return
+	}
+
+	app.releaseLoginAttempt(attempt)
+
+	if needsRehash {
+		app.rehashPassword(userEmail, requestPayload.Password)
+	}
+
+	app.beginLogin(w, r, userEmail)
+}
+
+// rehashPassword replaces a stored hash made with outdated parameters. The
+// user has just proven the password, so this is the only chance to upgrade
+// the hash without a reset. Failures are logged and sign-in carries on.
+func (app *application) rehashPassword(user *models.User, plain string) {
+	if err := user.HashPassword(plain, app.hashParams); err != nil {
+		log.Printf("rehash: unable to hash password for user %d: %v", user.ID, err)
+		return
+	}
+
+	if err := app.DB.UpdateUserPassword(user.ID, user.PasswordHash); err != nil {
+		log.Printf("rehash: unable to store password for user %d: %v", user.ID, err)
+	}
+}
+
+// beginLogin continues a sign-in once the user has proven their first
+// factor. Doctors awaiting approval are turned away, accounts with
+// two-factor authentication get an MFA challenge and everyone else is
+// signed in straight away.
+func (app *application) beginLogin(w http.ResponseWriter, r *http.Request, user *models.User) {
+	if !app.checkDoctorApproved(w, user) {
+		return
+	}
+
+	mfaEnabled, err := app.mfaEnabled(user.ID)
 	if err != nil {
-		_ = app.errorJSON(w, errors.New("invalid crediantial"), http.StatusBadRequest)
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
 		return
 	}
 
-	// Check password
-	valid, err := userEmail.PasswordMatches(requestPayload.Password)
-	if err != nil || !valid {
-		_ = app.errorJSON(w, errors.New("incorrect password"), http.StatusBadRequest)
+	if mfaEnabled {
+		id, err := app.issueUserToken(user.ID, models.TokenPurposeMFAChallenge, mfaChallengeExpiry)
+		if err != nil {
+			_ = app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		challenge, err := app.auth.GenerateMFAChallenge(user.ID, id)
+		if err != nil {
+			_ = app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		_ = app.writeJSON(w, http.StatusAccepted, map[string]any{
+			"message":      "two-factor authentication required",
+			"mfa_required": true,
+			"mfa_token":    challenge,
+		})
 		return
 	}
 
-	// create a jwt User
-	u := jwtUser{
-		ID:        userEmail.ID,
-		FirstName: userEmail.FirstName,
+	app.completeLogin(w, r, user)
+}
+
+// completeLogin finishes a successful sign-in: it forgets earlier failed
+// attempts, issues tokens with a fresh refresh cookie and writes the
+// response.
+func (app *application) completeLogin(w http.ResponseWriter, r *http.Request, user *models.User) {
+	if err := app.DB.ClearLoginFailures(string(user.Email)); err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
 	}
 
-	// generate token
-	tokens, err := app.auth.GenerateTokenPair(&u)
+	dto, err := app.userDTO(user)
 	if err != nil {
-		_ = app.errorJSON(w, err)
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
 		return
 	}
 
-	log.Println(tokens.Token)
-	refreshToken := app.auth.GetRefreshToken(tokens.RefreshToken)
-	http.SetCookie(w, refreshToken)
+	// generate tokens and set the refresh cookie
+	tokens, err := app.issueTokens(w, r, user, "")
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
 
 	_ = app.writeJSON(w, http.StatusAccepted, map[string]any{
-		"message": "welcome back " + userEmail.FirstName + ", This is LiveRight.",
-		"user": map[string]any{
-			"name":   userEmail.FirstName + " " + userEmail.LastName,
-			"email":  userEmail.Email,
-			"active": userEmail.Active,
-		},
-		"tokens": tokens,
+		"message": "welcome back " + user.FirstName + ", This is LiveRight.",
+		"user":    dto,
+		"tokens":  tokens,
 	})
 }
 
+// normalizePhone returns raw as an E.164 number, or nil when it is blank.
+// Phone numbers are stored normalised so phone sign-in can find them. An
+// invalid number gets a 400 response and ok is false.
+func (app *application) normalizePhone(w http.ResponseWriter, raw string) (number *string, ok bool) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, true
+	}
+
+	n, err := phone.Normalize(raw)
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return nil, false
+	}
+	return &n, true
+}
+
 // RegisterPatient
 func (app *application) RegisterPatient(w http.ResponseWriter, r *http.Request) {
 	var payload struct {
@@ -92,10 +210,8 @@ func (app *application) RegisterPatient(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// check existing
-	_, err := app.DB.GetUserByEmail(payload.Email)
-	if err == nil {
-		_ = app.errorJSON(w, errors.New("email already registered"), http.StatusBadRequest)
+	userPhone, ok := app.normalizePhone(w, payload.Phone)
+	if !ok {
 		return
 	}
 
@@ -103,42 +219,166 @@ func (app *application) RegisterPatient(w http.ResponseWriter, r *http.Request)
 		FirstName: payload.FirstName,
 		LastName:  payload.LastName,
 		Email:     models.Email(payload.Email),
-		Phone:     &payload.Phone,
+		Phone:     userPhone,
 		Active:    true,
 		RoleID:    models.Role{ID: 1}, // patient
 	}
-	if err := u.HashPassword(payload.Password); err != nil {
+
+	app.registerUser(w, payload.Password, u, app.DB.InsertUser)
+}
+
+// registerUser finishes a sign-up: it applies the password policy, hashes
+// the password and stores the account with insert, then emails a
+// verification link. The same response is written whether or not the email
+// was already registered.
+func (app *application) registerUser(w http.ResponseWriter, plain string, u *models.User, insert func(*models.User) (*models.User, error)) {
+	if !app.checkPasswordPolicy(w, plain, u) {
+		return
+	}
+
+	// hash before looking for an existing account so both outcomes take
+	// the same time
+	if err := u.HashPassword(plain, app.hashParams); err != nil {
 		_ = app.errorJSON(w, errors.New("unable to hash password"), http.StatusInternalServerError)
 		return
 	}
 
-	newUser, err := app.DB.InsertUser(u)
+	existing, err := app.DB.GetUserByEmail(string(u.Email))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if existing == nil {
+		newUser, err := insert(u)
+		switch {
+		case errors.Is(err, repository.ErrDuplicate):
+			// registered concurrently; fall through to the generic response
+		case err != nil:
+			_ = app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		default:
+			if err := app.sendVerificationEmail(newUser); err != nil {
+				_ = app.errorJSON(w, err, http.StatusInternalServerError)
+				return
+			}
+		}
+	} else {
+		app.sendExistingAccountEmail(existing)
+	}
+
+	// The same answer is given whether or not the email was already
+	// registered; only the owner of the address learns which happened.
+	_ = app.writeJSON(w, http.StatusAccepted, JSONResponse{
+		Message: "registration received, please check your email to continue",
+	})
+}
+
+// RefreshToken exchanges the refresh token cookie for a new token pair and
+// rotates the cookie. The presented refresh token is marked as rotated; if it
+// is ever presented again its whole family is revoked.
+func (app *application) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	stored, err := app.lookupRefreshToken(r)
+	if err != nil {
+		http.SetCookie(w, app.auth.GetExpiredRefreshToken())
+		_ = app.errorJSON(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	if stored.RotatedAt != nil {
+		if err := app.handleRefreshTokenReuse(r, stored); err != nil {
+			_ = app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+		http.SetCookie(w, app.auth.GetExpiredRefreshToken())
+		_ = app.errorJSON(w, errInvalidRefreshToken, http.StatusUnauthorized)
+		return
+	}
+
+	if !stored.Valid() {
+		http.SetCookie(w, app.auth.GetExpiredRefreshToken())
+		_ = app.errorJSON(w, errInvalidRefreshToken, http.StatusUnauthorized)
+		return
+	}
+
+	user, err := app.DB.GetUserByID(stored.UserID)
+	if err != nil {
+		http.SetCookie(w, app.auth.GetExpiredRefreshToken())
+		_ = app.errorJSON(w, errInvalidRefreshToken, http.StatusUnauthorized)
+		return
+	}
+
+	if !user.Active {
+		http.SetCookie(w, app.auth.GetExpiredRefreshToken())
+		_ = app.errorJSON(w, errors.New("account is inactive"), http.StatusForbidden)
+		return
+	}
+
+	// Rotating is conditional on the token still being live, so when two
+	// requests race with the same token only one of them wins.
+	rotated, err := app.DB.RotateRefreshToken(stored.TokenHash)
 	if err != nil {
 		_ = app.errorJSON(w, err, http.StatusInternalServerError)
 		return
 	}
 
-	j := jwtUser{
-		ID:        newUser.ID,
-		FirstName: newUser.FirstName,
-		LastName:  newUser.LastName,
+	if !rotated {
+		if err := app.handleRefreshTokenReuse(r, stored); err != nil {
+			_ = app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+		http.SetCookie(w, app.auth.GetExpiredRefreshToken())
+		_ = app.errorJSON(w, errInvalidRefreshToken, http.StatusUnauthorized)
+		return
 	}
 
-	tokens, err := app.auth.GenerateTokenPair(&j)
+	tokens, err := app.issueTokens(w, r, user, stored.FamilyID)
 	if err != nil {
 		_ = app.errorJSON(w, err, http.StatusInternalServerError)
 		return
 	}
 
-	http.SetCookie(w, app.auth.GetRefreshToken(tokens.RefreshToken))
+	_ = app.writeJSON(w, http.StatusOK, map[string]any{
+		"message": "token refreshed",
+		"tokens":  tokens,
+	})
+}
+
+// Logout ends the session the refresh token cookie belongs to and clears
+// the cookie. It succeeds even when there is no valid session so clients can
+// always reach a logged-out state.
+func (app *application) Logout(w http.ResponseWriter, r *http.Request) {
+	if stored, err := app.lookupRefreshToken(r); err == nil {
+		if err := app.DB.RevokeRefreshTokenFamily(stored.FamilyID); err != nil {
+			_ = app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	http.SetCookie(w, app.auth.GetExpiredRefreshToken())
+
+	_ = app.writeJSON(w, http.StatusOK, JSONResponse{
+		Message: "logged out",
+	})
+}
+
+// LogoutAll revokes every refresh token belonging to the authenticated user,
+// ending all of their sessions.
+func (app *application) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	p, ok := principalFromContext(r.Context())
+	if !ok {
+		_ = app.errorJSON(w, errors.New("authorization required"), http.StatusUnauthorized)
+		return
+	}
+
+	if err := app.DB.RevokeAllRefreshTokens(p.ID); err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, app.auth.GetExpiredRefreshToken())
 
-	_ = app.writeJSON(w, http.StatusCreated, map[string]any{
-		"message": "patient registered",
-		"user": map[string]any{
-			"id":         newUser.ID,
-			"first_name": newUser.FirstName,
-			"email":      newUser.Email,
-		},
-		"tokens": tokens,
+	_ = app.writeJSON(w, http.StatusOK, JSONResponse{
+		Message: "logged out of all sessions",
 	})
 }
@@ -0,0 +1,17 @@
+package main
+
+import "time"
+
+// runEvery calls job in the background straight away and then once every
+// interval. Runs never overlap.
+func runEvery(interval time.Duration, job func()) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			job()
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// KeySet holds the private key used to sign tokens and the public keys that
+// are accepted when verifying them. Keys are identified by their RFC 7638
+// thumbprint, which is written to the kid header of every token we sign.
+//
+// To rotate keys, deploy the new public key as a verification key first so
+// every instance (and every partner reading the JWKS) knows it, then switch
+// the signing key. Keep the old public key as a verification key until the
+// longest-lived token it signed has expired.
+type KeySet struct {
+	signingKeyID string
+	signingKey   crypto.Signer
+	method       jwt.SigningMethod
+	publicKeys   map[string]crypto.PublicKey
+	keyOrder     []string
+}
+
+// LoadKeySet reads a PEM encoded private signing key (Ed25519 or RSA, PKCS#8
+// or PKCS#1) and any number of additional PEM encoded verification keys,
+// which may be public or private keys.
+func LoadKeySet(signingKeyPath string, verificationKeyPaths []string) (*KeySet, error) {
+	key, err := readPEMKey(signingKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("signing key: %w", err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("signing key %s is not a private key", signingKeyPath)
+	}
+
+	ks, err := newKeySet(signer)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range verificationKeyPaths {
+		key, err := readPEMKey(path)
+		if err != nil {
+			return nil, fmt.Errorf("verification key: %w", err)
+		}
+
+		if signer, ok := key.(crypto.Signer); ok {
+			key = signer.Public()
+		}
+
+		if err := ks.addPublicKey(key); err != nil {
+			return nil, fmt.Errorf("verification key %s: %w", path, err)
+		}
+	}
+
+	return ks, nil
+}
+
+// NewEphemeralKeySet generates a throwaway Ed25519 key. Tokens signed with
+// it stop verifying when the process exits, so it is only meant for local
+// development.
+func NewEphemeralKeySet() (*KeySet, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return newKeySet(private)
+}
+
+func newKeySet(signer crypto.Signer) (*KeySet, error) {
+	method, err := signingMethodFor(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	ks := &KeySet{
+		signingKey: signer,
+		method:     method,
+		publicKeys: make(map[string]crypto.PublicKey),
+	}
+
+	if err := ks.addPublicKey(signer.Public()); err != nil {
+		return nil, err
+	}
+	ks.signingKeyID = ks.keyOrder[0]
+
+	return ks, nil
+}
+
+func (ks *KeySet) addPublicKey(key crypto.PublicKey) error {
+	kid, err := keyThumbprint(key)
+	if err != nil {
+		return err
+	}
+
+	if _, exists := ks.publicKeys[kid]; !exists {
+		ks.publicKeys[kid] = key
+		ks.keyOrder = append(ks.keyOrder, kid)
+	}
+
+	return nil
+}
+
+// Sign signs claims with the current signing key and sets the kid header.
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.method, claims)
+	token.Header["kid"] = ks.signingKeyID
+	return token.SignedString(ks.signingKey)
+}
+
+// Keyfunc resolves the verification key named by a token's kid header. It is
+// meant to be passed to jwt.Parse.
+func (ks *KeySet) Keyfunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, ok := ks.publicKeys[kid]
+	if !ok {
+		return nil, errors.New("unknown signing key")
+	}
+
+	method, err := signingMethodFor(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Refuse tokens whose alg header does not belong to the key, so a key
+	// can never be used with an algorithm it was not issued for.
+	if token.Method.Alg() != method.Alg() {
+		return nil, errors.New("unexpected signing method")
+	}
+
+	return key, nil
+}
+
+// ValidMethods lists the algorithms that Keyfunc can return keys for.
+func (ks *KeySet) ValidMethods() []string {
+	return []string{jwt.SigningMethodEdDSA.Alg(), jwt.SigningMethodRS256.Alg()}
+}
+
+// JWK is a public JSON Web Key as published in the JWKS document.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+// JWKS returns every verification key, signing key first.
+func (ks *KeySet) JWKS() []JWK {
+	keys := make([]JWK, 0, len(ks.keyOrder))
+
+	for _, kid := range ks.keyOrder {
+		jwk, err := publicJWK(ks.publicKeys[kid])
+		if err != nil {
+			continue
+		}
+		jwk.KeyID = kid
+		jwk.Use = "sig"
+		keys = append(keys, jwk)
+	}
+
+	return keys
+}
+
+func signingMethodFor(key crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	case *rsa.PublicKey:
+		if k.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		return jwt.SigningMethodRS256, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+}
+
+func publicJWK(key crypto.PublicKey) (JWK, error) {
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		return JWK{
+			KeyType:   "OKP",
+			Algorithm: jwt.SigningMethodEdDSA.Alg(),
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(k),
+		}, nil
+	case *rsa.PublicKey:
+		return JWK{
+			KeyType:   "RSA",
+			Algorithm: jwt.SigningMethodRS256.Alg(),
+			N:         base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+			E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		}, nil
+	default:
+		return JWK{}, fmt.Errorf("unsupported key type %T", key)
+	}
+}
+
+// keyThumbprint computes the RFC 7638 JWK thumbprint of a public key.
+func keyThumbprint(key crypto.PublicKey) (string, error) {
+	jwk, err := publicJWK(key)
+	if err != nil {
+		return "", err
+	}
+
+	// RFC 7638 hashes only the required members, in lexicographic order.
+	var members any
+	switch jwk.KeyType {
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Curve, jwk.KeyType, jwk.X}
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.KeyType, jwk.N}
+	}
+
+	raw, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+func readPEMKey(path string) (any, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, fmt.Errorf("%s does not contain a PEM block", path)
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golangnigeria/liveright_backend/internal/mailer"
+	"github.com/golangnigeria/liveright_backend/internal/models"
+)
+
+// MagicLinkSettings limits how many sign-in links are sent: at most
+// MaxSends to one address, and MaxSendsPerIP requested from one client IP,
+// over SendWindow.
+type MagicLinkSettings struct {
+	SendWindow    time.Duration
+	MaxSends      int
+	MaxSendsPerIP int
+}
+
+var (
+	errInvalidMagicLink  = errors.New("invalid or expired sign-in link")
+	errTooManyMagicLinks = errors.New("too many sign-in links requested, please try again later")
+)
+
+// nonceHash returns the form of a device nonce carried in magic link
+// tokens, so the emailed link never contains the nonce itself.
+func nonceHash(nonce string) string {
+	return base64.RawURLEncoding.EncodeToString(hashToken(nonce))
+}
+
+// RequestMagicLink emails a sign-in link to the given address and binds it
+// to the requesting device with a nonce cookie. The response is the same
+// whether or not an account exists.
+func (app *application) RequestMagicLink(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Email string `json:"email"`
+	}
+
+	if err := app.readJSON(w, r, &payload); err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	since := time.Now().Add(-app.magicLinkSettings.SendWindow)
+
+	sentToIP, err := app.DB.CountMagicLinkRequestsByIP(clientIP(r), since)
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	sentToEmail, err := app.DB.CountMagicLinkRequests(payload.Email, since)
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if sentToIP >= app.magicLinkSettings.MaxSendsPerIP || sentToEmail >= app.magicLinkSettings.MaxSends {
+		w.Header().Set("Retry-After", retryAfter(app.magicLinkSettings.SendWindow))
+		_ = app.errorJSON(w, errTooManyMagicLinks, http.StatusTooManyRequests)
+		return
+	}
+
+	// the request is recorded either way so send limits behave the same for
+	// every address
+	if err := app.DB.InsertMagicLinkRequest(payload.Email, clientIP(r)); err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	nonce, err := generateRandomToken()
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	user, err := app.DB.GetUserByEmail(payload.Email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err == nil && user.Active {
+		// the stored token doubles as the link's ID, making it single-use
+		// and replacing any earlier link
+		id, err := app.issueUserToken(user.ID, models.TokenPurposeMagicLink, magicLinkExpiry)
+		if err != nil {
+			_ = app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		link, err := app.auth.GenerateMagicLink(user.ID, id, nonceHash(nonce))
+		if err != nil {
+			_ = app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		app.sendEmail(mailer.Message{
+			To:      string(user.Email),
+			Subject: "Your LiveRight sign-in link",
+			Body: fmt.Sprintf(
+				"Hello %s,\n\nUse the link below to sign in to LiveRight. It expires in %d minutes, can only be used once and only works on the device where you asked for it.\n\n%s\n\nIf you did not ask for this, you can ignore this email.",
+				user.FirstName, int(magicLinkExpiry.Minutes()), app.frontendLink("/magic-link", link),
+			),
+		})
+	}
+
+	http.SetCookie(w, app.auth.GetMagicLinkCookie(nonce))
+
+	_ = app.writeJSON(w, http.StatusAccepted, JSONResponse{
+		Message: "if an account exists for that email, a sign-in link has been sent",
+	})
+}
+
+// VerifyMagicLink exchanges a magic link token for tokens. It only works
+// from the device holding the nonce cookie set when the link was requested.
+func (app *application) VerifyMagicLink(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Token string `json:"token"`
+	}
+
+	if err := app.readJSON(w, r, &payload); err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	claims, err := app.auth.ParseMagicLink(payload.Token)
+	if err != nil {
+		_ = app.errorJSON(w, errInvalidMagicLink, http.StatusUnauthorized)
+		return
+	}
+
+	cookie, err := r.Cookie(magicLinkCookieName)
+	if err != nil || subtle.ConstantTimeCompare([]byte(nonceHash(cookie.Value)), []byte(claims.Nonce)) != 1 {
+		_ = app.errorJSON(w, errors.New("this sign-in link must be opened on the device that requested it"), http.StatusUnauthorized)
+		return
+	}
+
+	token, err := app.DB.ConsumeUserToken(hashToken(claims.ID), models.TokenPurposeMagicLink)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			_ = app.errorJSON(w, errInvalidMagicLink, http.StatusUnauthorized)
+			return
+		}
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if formatID(token.UserID) != claims.Subject {
+		_ = app.errorJSON(w, errInvalidMagicLink, http.StatusUnauthorized)
+		return
+	}
+
+	user, err := app.DB.GetUserByID(token.UserID)
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if !user.Active {
+		_ = app.errorJSON(w, errInvalidMagicLink, http.StatusUnauthorized)
+		return
+	}
+
+	// following the link proves the user controls the address
+	if !user.EmailVerified() {
+		if err := app.DB.SetEmailVerified(user.ID); err != nil {
+			_ = app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+		user, err = app.DB.GetUserByID(user.ID)
+		if err != nil {
+			_ = app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+		app.audit(r, &user.ID, models.AuditEmailVerified, nil)
+	}
+
+	http.SetCookie(w, app.auth.GetExpiredMagicLinkCookie())
+
+	app.beginLogin(w, r, user)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golangnigeria/liveright_backend/internal/mailer"
+)
+
+const mailTimeout = time.Second * 30
+
+// sendEmail delivers msg in the background. Handlers never wait for mail
+// delivery, which also keeps response times independent of whether a
+// message was sent at all.
+func (app *application) sendEmail(msg mailer.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+		defer cancel()
+
+		if err := app.Mailer.Send(ctx, msg); err != nil {
+			log.Printf("mail: unable to send %q: %v", msg.Subject, err)
+		}
+	}()
+}
+
+// frontendLink builds a link into the web client carrying token as a query
+// parameter.
+func (app *application) frontendLink(path, token string) string {
+	return strings.TrimRight(app.FrontendURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+// apiLink builds a link to this API carrying token as a query parameter.
+func (app *application) apiLink(path, token string) string {
+	return strings.TrimRight(app.APIURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
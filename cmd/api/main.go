@@ -1,29 +1,60 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/golangnigeria/liveright_backend/internal/mailer"
+	"github.com/golangnigeria/liveright_backend/internal/password"
 	"github.com/golangnigeria/liveright_backend/internal/repository"
 	"github.com/golangnigeria/liveright_backend/internal/repository/dbrepo"
+	"github.com/golangnigeria/liveright_backend/internal/sms"
 	"github.com/joho/godotenv"
 )
 
 const port = 8080
 
 type application struct {
-	Domain       string
-	DSN          string
-	DB           repository.DatabaseRepo
-	auth         Auth
-	JwtSecret    string
-	JWTIssuer    string
-	JWTAudienc   string
-	CookieDomain string
+	Domain               string
+	DSN                  string
+	DB                   repository.DatabaseRepo
+	auth                 Auth
+	JWTSigningKey        string
+	JWTVerificationKeys  string
+	DevEphemeralKey      bool
+	JWTIssuer            string
+	JWTAudienc           string
+	CookieDomain         string
+	FrontendURL          string
+	APIURL               string
+	MailDir              string
+	BreachedPasswords    string
+	AllowMissingBreached bool
+	Mailer               mailer.Mailer
+	SMS                  sms.Sender
+	loginThrottle        LoginThrottle
+	otpSettings          OTPSettings
+	magicLinkSettings    MagicLinkSettings
+	passwordPolicy       password.Policy
+
+	// deletionGracePeriod is how long a deletion request can be cancelled
+	// before the account is anonymised.
+	deletionGracePeriod time.Duration
+
+	// hashParams configures new password hashes; stored hashes made
+	// otherwise are replaced when their owner next signs in.
+	hashParams password.Params
+
+	// dummyPasswords stand in for a password hash when sign-in is tried
+	// with an unknown email.
+	dummyPasswords *dummyPasswords
 }
 
 func main() {
@@ -37,11 +68,28 @@ func main() {
 
 	// Set flags, default to environment variables if they exist
 	flag.StringVar(&app.DSN, "dsn", os.Getenv("DATABASE_URL"), "Postgres DSN")
-	flag.StringVar(&app.JwtSecret, "jwt-secret", os.Getenv("JWT_SECRET"), "Signing secret")
+	flag.StringVar(&app.JWTSigningKey, "jwt-signing-key", os.Getenv("JWT_SIGNING_KEY"), "Path to the PEM private key used to sign tokens")
+	flag.StringVar(&app.JWTVerificationKeys, "jwt-verification-keys", os.Getenv("JWT_VERIFICATION_KEYS"), "Comma-separated paths to extra PEM keys accepted when verifying tokens")
+	flag.BoolVar(&app.DevEphemeralKey, "dev-ephemeral-key", false, "Development only: sign tokens with a throwaway key when no signing key is configured")
 	flag.StringVar(&app.JWTIssuer, "jwt-issuer", os.Getenv("JWT_ISSUER"), "Signing issuer")
 	flag.StringVar(&app.JWTAudienc, "jwt-audience", os.Getenv("JWT_AUDIENCE"), "Signing audience")
 	flag.StringVar(&app.CookieDomain, "cookie-domain", os.Getenv("COOKIE_DOMAIN"), "Cookie domain")
 	flag.StringVar(&app.Domain, "domain", os.Getenv("DOMAIN"), "Domain")
+	flag.StringVar(&app.BreachedPasswords, "breached-passwords", envOr("BREACHED_PASSWORDS", "data/breached-passwords.txt.gz"), "Path to the gzip compressed list of breached passwords")
+	flag.BoolVar(&app.AllowMissingBreached, "allow-missing-breached-list", false, "Start without the breached password check when the list cannot be loaded")
+	flag.StringVar(&app.FrontendURL, "frontend-url", os.Getenv("FRONTEND_URL"), "Base URL of the web client, used in emailed links")
+	flag.StringVar(&app.APIURL, "api-url", os.Getenv("API_URL"), "Public base URL of this API, used in download links")
+	flag.StringVar(&app.MailDir, "mail-dir", os.Getenv("MAIL_DIR"), "Write outgoing email to files in this directory instead of the log")
+
+	hashParams := password.DefaultParams
+	hashParams.Algorithm = password.Algorithm(envOr("PASSWORD_HASH", string(hashParams.Algorithm)))
+	flag.Func("password-hash", "Password hashing algorithm for new hashes: argon2id or bcrypt", func(v string) error {
+		hashParams.Algorithm = password.Algorithm(v)
+		return nil
+	})
+	flag.IntVar(&hashParams.BcryptCost, "bcrypt-cost", hashParams.BcryptCost, "bcrypt cost")
+	flag.Func("argon2-memory", "argon2id memory in KiB", uintFlag(&hashParams.Argon2Memory))
+	flag.Func("argon2-iterations", "argon2id iterations", uintFlag(&hashParams.Argon2Iterations))
 
 	flag.Parse()
 
@@ -60,10 +108,15 @@ func main() {
 		}
 	}()
 
+	keys, err := app.loadKeys()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	app.auth = Auth{
 		Issuer:        app.JWTIssuer,
 		Audience:      app.JWTAudienc,
-		Secret:        app.JwtSecret,
+		Keys:          keys,
 		TokenExpiry:   time.Minute * 15,
 		RefreshExpiry: time.Hour * 24,
 		CookiePath:    "/",
@@ -71,6 +124,73 @@ func main() {
 		CookieDomain:  app.Domain,
 	}
 
+	if app.MailDir != "" {
+		app.Mailer = &mailer.FileMailer{Dir: app.MailDir}
+	} else {
+		app.Mailer = &mailer.LogMailer{}
+	}
+	app.SMS = &sms.LogSender{}
+
+	if err := hashParams.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	app.hashParams = hashParams
+
+	app.passwordPolicy = password.Policy{
+		MinLength:           10,
+		MaxBytes:            1024,
+		MinCharacterClasses: 2,
+	}
+
+	// bcrypt ignores everything past 72 bytes
+	if hashParams.Algorithm == password.Bcrypt {
+		app.passwordPolicy.MaxBytes = 72
+	}
+
+	breached, err := password.LoadBreachedList(app.BreachedPasswords)
+	switch {
+	case err == nil:
+		app.passwordPolicy.Breached = breached
+		log.Printf("Loaded %d breached passwords", breached.Len())
+	case app.AllowMissingBreached:
+		log.Println("breached password list not loaded, skipping that check:", err)
+	default:
+		log.Fatalf("unable to load breached password list %q (pass -allow-missing-breached-list to run without it): %v", app.BreachedPasswords, err)
+	}
+
+	app.dummyPasswords, err = app.newDummyPasswords()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	app.loginThrottle = LoginThrottle{
+		Window:        time.Minute * 15,
+		FreeAttempts:  3,
+		MaxDelay:      time.Minute,
+		LockThreshold: 10,
+		LockDuration:  time.Minute * 30,
+		MaxPerIP:      50,
+	}
+
+	app.otpSettings = OTPSettings{
+		TTL:           time.Minute * 5,
+		MaxAttempts:   5,
+		SendWindow:    time.Hour,
+		MaxSends:      5,
+		MaxSendsPerIP: 20,
+	}
+
+	app.magicLinkSettings = MagicLinkSettings{
+		SendWindow:    time.Hour,
+		MaxSends:      5,
+		MaxSendsPerIP: 20,
+	}
+
+	app.deletionGracePeriod = time.Hour * 24 * 30
+
+	runEvery(time.Hour, app.processAccountDeletions)
+	runEvery(time.Minute, app.processDataExports)
+
 	log.Println("Starting application on port", port)
 
 	// Start the web server
@@ -79,3 +199,45 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// loadKeys builds the token signing key set from the configured key files.
+// A throwaway key is only used when no signing key is configured and
+// -dev-ephemeral-key asks for one; otherwise a missing key is an error.
+func (app *application) loadKeys() (*KeySet, error) {
+	if app.JWTSigningKey == "" {
+		if !app.DevEphemeralKey {
+			return nil, errors.New("no JWT signing key configured: set JWT_SIGNING_KEY, or pass -dev-ephemeral-key for local development")
+		}
+		log.Println("no JWT signing key configured, using an ephemeral key; tokens will not survive a restart")
+		return NewEphemeralKeySet()
+	}
+
+	var verificationKeys []string
+	for _, path := range strings.Split(app.JWTVerificationKeys, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			verificationKeys = append(verificationKeys, path)
+		}
+	}
+
+	return LoadKeySet(app.JWTSigningKey, verificationKeys)
+}
+
+// envOr returns the environment variable key, or fallback when it is unset.
+func envOr(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
+// uintFlag returns a flag.Func setter that parses a uint32 into dst.
+func uintFlag(dst *uint32) func(string) error {
+	return func(v string) error {
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return err
+		}
+		*dst = uint32(n)
+		return nil
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golangnigeria/liveright_backend/internal/models"
+	"github.com/golangnigeria/liveright_backend/internal/totp"
+)
+
+const (
+	totpIssuer        = "LiveRight"
+	totpSkew          = 1
+	recoveryCodeCount = 10
+)
+
+var (
+	errInvalidMFACode  = errors.New("invalid authentication code")
+	errInvalidMFAToken = errors.New("invalid or expired mfa token")
+)
+
+// mfaEnabled reports whether the user has a confirmed TOTP enrollment.
+func (app *application) mfaEnabled(userID int64) (bool, error) {
+	t, err := app.DB.GetTOTP(userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	return t.Enabled(), nil
+}
+
+// verifySecondFactor checks either a TOTP code or, when one is given, a
+// recovery code. Accepted codes are consumed so they cannot be replayed.
+func (app *application) verifySecondFactor(r *http.Request, userID int64, code, recoveryCode string) (bool, error) {
+	if recoveryCode != "" {
+		used, err := app.DB.UseRecoveryCode(userID, hashToken(normalizeRecoveryCode(recoveryCode)))
+		if err != nil || !used {
+			return false, err
+		}
+		app.audit(r, &userID, models.AuditRecoveryCodeUsed, nil)
+		return true, nil
+	}
+
+	t, err := app.DB.GetTOTP(userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if !t.Enabled() {
+		return false, nil
+	}
+
+	step, ok := totp.Validate(t.Secret, strings.TrimSpace(code), time.Now(), totpSkew)
+	if !ok {
+		return false, nil
+	}
+
+	return app.DB.UseTOTPStep(userID, step)
+}
+
+// checkSecondFactor verifies a TOTP or recovery code for user. Codes are
+// short, so guesses are throttled like passwords: each one reserves a
+// sign-in attempt, which is only released when the code is right. When the
+// check fails it writes a response and returns false.
+func (app *application) checkSecondFactor(w http.ResponseWriter, r *http.Request, user *models.User, code, recoveryCode string) bool {
+	attempt, ok := app.reserveLoginAttempt(w, r, string(user.Email))
+	if !ok {
+		return false
+	}
+
+	ok, err := app.verifySecondFactor(r, user.ID, code, recoveryCode)
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return false
+	}
+
+	if !ok {
+		if err := app.recordLoginFailure(r, string(user.Email), &user.ID); err != nil {
+			_ = app.errorJSON(w, err, http.StatusInternalServerError)
+			return false
+		}
+		_ = app.errorJSON(w, errInvalidMFACode, http.StatusUnauthorized)
+		return false
+	}
+
+	app.releaseLoginAttempt(attempt)
+	return true
+}
+
+// VerifyMFA completes a sign-in that Authenticate answered with an MFA
+// challenge, exchanging the challenge and a second factor for tokens.
+func (app *application) VerifyMFA(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	if err := app.readJSON(w, r, &payload); err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	claims, err := app.auth.ParseMFAChallenge(payload.MFAToken)
+	if err != nil {
+		_ = app.errorJSON(w, errInvalidMFAToken, http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		_ = app.errorJSON(w, errInvalidMFAToken, http.StatusUnauthorized)
+		return
+	}
+
+	user, err := app.DB.GetUserByID(userID)
+	if err != nil {
+		_ = app.errorJSON(w, errInvalidMFAToken, http.StatusUnauthorized)
+		return
+	}
+
+	// the challenge is checked before the second factor is spent, so a
+	// used or foreign challenge cannot burn a recovery code
+	challenge, err := app.DB.GetValidUserToken(hashToken(claims.ID), models.TokenPurposeMFAChallenge)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			_ = app.errorJSON(w, errInvalidMFAToken, http.StatusUnauthorized)
+			return
+		}
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if challenge.UserID != user.ID {
+		_ = app.errorJSON(w, errInvalidMFAToken, http.StatusUnauthorized)
+		return
+	}
+
+	if !app.checkSecondFactor(w, r, user, payload.Code, payload.RecoveryCode) {
+		return
+	}
+
+	// the challenge is spent only once the second factor checks out, so a
+	// mistyped code can be corrected without signing in again
+	if _, err := app.DB.ConsumeUserToken(hashToken(claims.ID), models.TokenPurposeMFAChallenge); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			_ = app.errorJSON(w, errInvalidMFAToken, http.StatusUnauthorized)
+			return
+		}
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.completeLogin(w, r, user)
+}
+
+// EnrollTOTP starts TOTP enrollment and returns the secret and otpauth://
+// URI for the user's authenticator app. The enrollment has no effect until
+// ConfirmTOTP succeeds.
+func (app *application) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	p, ok := principalFromContext(r.Context())
+	if !ok {
+		_ = app.errorJSON(w, errors.New("authorization required"), http.StatusUnauthorized)
+		return
+	}
+
+	enabled, err := app.mfaEnabled(p.ID)
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if enabled {
+		_ = app.errorJSON(w, errors.New("two-factor authentication is already enabled"), http.StatusConflict)
+		return
+	}
+
+	user, err := app.DB.GetUserByID(p.ID)
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.DB.UpsertTOTP(user.ID, secret); err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, map[string]any{
+		"message":     "scan the code with your authenticator app, then confirm with a code",
+		"secret":      totp.EncodeSecret(secret),
+		"otpauth_uri": totp.URI(totpIssuer, string(user.Email), secret),
+	})
+}
+
+// ConfirmTOTP enables two-factor authentication once the user proves their
+// authenticator app works, and returns one-time recovery codes. The codes
+// are only ever shown here.
+func (app *application) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	p, ok := principalFromContext(r.Context())
+	if !ok {
+		_ = app.errorJSON(w, errors.New("authorization required"), http.StatusUnauthorized)
+		return
+	}
+
+	var payload struct {
+		Code string `json:"code"`
+	}
+
+	if err := app.readJSON(w, r, &payload); err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	t, err := app.DB.GetTOTP(p.ID)
+	if err != nil {
+		app.notFoundOrError(w, err, "no two-factor enrollment in progress")
+		return
+	}
+
+	if t.Enabled() {
+		_ = app.errorJSON(w, errors.New("two-factor authentication is already enabled"), http.StatusConflict)
+		return
+	}
+
+	step, valid := totp.Validate(t.Secret, strings.TrimSpace(payload.Code), time.Now(), totpSkew)
+	if !valid {
+		_ = app.errorJSON(w, errInvalidMFACode, http.StatusBadRequest)
+		return
+	}
+
+	if _, err := app.DB.UseTOTPStep(p.ID, step); err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.DB.ConfirmTOTP(p.ID, hashes); err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.audit(r, &p.ID, models.AuditMFAEnabled, nil)
+
+	_ = app.writeJSON(w, http.StatusOK, map[string]any{
+		"message":        "two-factor authentication enabled, store these recovery codes somewhere safe",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTOTP turns off two-factor authentication. It requires the
+// account password and a current code or recovery code.
+func (app *application) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	p, ok := principalFromContext(r.Context())
+	if !ok {
+		_ = app.errorJSON(w, errors.New("authorization required"), http.StatusUnauthorized)
+		return
+	}
+
+	var payload struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	if err := app.readJSON(w, r, &payload); err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := app.DB.GetUserByID(p.ID)
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if !app.confirmPassword(w, r, user, payload.Password) {
+		return
+	}
+
+	if !app.checkSecondFactor(w, r, user, payload.Code, payload.RecoveryCode) {
+		return
+	}
+
+	if err := app.DB.DeleteTOTP(user.ID); err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.audit(r, &user.ID, models.AuditMFADisabled, nil)
+
+	_ = app.writeJSON(w, http.StatusOK, JSONResponse{
+		Message: "two-factor authentication disabled",
+	})
+}
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateRecoveryCodes returns n random codes formatted for display as
+// xxxxx-xxxxx, along with the hashes to store.
+func generateRecoveryCodes(n int) ([]string, [][]byte, error) {
+	codes := make([]string, 0, n)
+	hashes := make([][]byte, 0, n)
+
+	for range n {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+
+		raw := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))[:10]
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, hashToken(raw))
+	}
+
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode strips the formatting users may type along with a
+// recovery code.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -1,6 +1,17 @@
 package main
 
-import "net/http"
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/golangnigeria/liveright_backend/internal/models"
+)
 
 func (app *application) enableCORS(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -16,3 +27,257 @@ func (app *application) enableCORS(h http.Handler) http.Handler {
 		}
 	})
 }
+
+// RequireAuth rejects requests without a valid "Authorization: Bearer"
+// access token and stores the caller's Principal in the request context.
+func (app *application) RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+
+		scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			_ = app.errorJSON(w, errors.New("authorization required"), http.StatusUnauthorized)
+			return
+		}
+
+		claims, err := app.auth.ParseAccessToken(token)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			_ = app.errorJSON(w, errors.New("invalid or expired token"), http.StatusUnauthorized)
+			return
+		}
+
+		id, err := strconv.ParseInt(claims.Subject, 10, 64)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			_ = app.errorJSON(w, errors.New("invalid or expired token"), http.StatusUnauthorized)
+			return
+		}
+
+		p := &Principal{
+			ID:            id,
+			Name:          claims.Name,
+			Role:          claims.Role,
+			EmailVerified: claims.EmailVerified,
+			SessionID:     claims.SessionID,
+		}
+
+		if claims.Actor != nil {
+			p.ImpersonatorID, err = strconv.ParseInt(claims.Actor.Subject, 10, 64)
+			if err != nil || p.ImpersonatorID == 0 {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				_ = app.errorJSON(w, errors.New("invalid or expired token"), http.StatusUnauthorized)
+				return
+			}
+		}
+
+		r = r.WithContext(contextWithPrincipal(r.Context(), p))
+
+		if !p.Impersonated() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// every request made while impersonating is audited against the
+		// admin, together with its outcome
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		app.audit(r, &p.ImpersonatorID, models.AuditImpersonatedRequest, map[string]any{
+			"impersonated_user_id": p.ID,
+			"method":               r.Method,
+			"path":                 r.URL.Path,
+			"status":               ww.Status(),
+		})
+	})
+}
+
+// DenyImpersonation refuses high-risk actions, such as payments and
+// changes to credentials, to admins impersonating a user. It must be
+// mounted after RequireAuth.
+func (app *application) DenyImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p, ok := principalFromContext(r.Context()); ok && p.Impersonated() {
+			_ = app.errorJSON(w, errors.New("this action is not allowed while impersonating a user"), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireRole only lets through callers whose role is one of roles. It must
+// be mounted after RequireAuth.
+func (app *application) RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := principalFromContext(r.Context())
+			if !ok {
+				_ = app.errorJSON(w, errors.New("authorization required"), http.StatusUnauthorized)
+				return
+			}
+
+			if !slices.Contains(roles, p.Role) {
+				_ = app.errorJSON(w, errors.New("you do not have access to this resource"), http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequirePermission only lets through callers whose role grants every one of
+// permissions. Permissions are looked up on each request so that changes to
+// a role take effect immediately. It must be mounted after RequireAuth.
+func (app *application) RequirePermission(permissions ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := principalFromContext(r.Context())
+			if !ok {
+				_ = app.errorJSON(w, errors.New("authorization required"), http.StatusUnauthorized)
+				return
+			}
+
+			for _, permission := range permissions {
+				allowed, err := app.DB.UserHasPermission(p.ID, permission)
+				if err != nil {
+					_ = app.errorJSON(w, err, http.StatusInternalServerError)
+					return
+				}
+				if !allowed {
+					_ = app.errorJSON(w, errors.New("you do not have access to this resource"), http.StatusForbidden)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireVerifiedEmail only lets through callers who have confirmed their
+// email address. The check uses the access token, so a user who has just
+// verified must refresh their tokens first. It must be mounted after
+// RequireAuth.
+func (app *application) RequireVerifiedEmail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := principalFromContext(r.Context())
+		if !ok {
+			_ = app.errorJSON(w, errors.New("authorization required"), http.StatusUnauthorized)
+			return
+		}
+
+		if !p.EmailVerified {
+			_ = app.errorJSON(w, errors.New("please verify your email address first"), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireAPIKey rejects requests without a valid "Authorization: ApiKey"
+// partner key and stores the calling APIClient in the request context.
+func (app *application) RequireAPIKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+
+		scheme, plain, found := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !found || !strings.EqualFold(scheme, "ApiKey") || plain == "" {
+			w.Header().Set("WWW-Authenticate", "ApiKey")
+			_ = app.errorJSON(w, errors.New("authorization required"), http.StatusUnauthorized)
+			return
+		}
+
+		key, err := app.lookupAPIKey(plain)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `ApiKey error="invalid_key"`)
+			_ = app.errorJSON(w, errInvalidAPIKey, http.StatusUnauthorized)
+			return
+		}
+
+		if err := app.DB.TouchAPIKey(key.ID); err != nil {
+			log.Printf("api key %d: unable to record use: %v", key.ID, err)
+		}
+
+		c := &APIClient{
+			KeyID:          key.ID,
+			OrganisationID: key.OrganisationID,
+			Scopes:         key.Scopes,
+		}
+
+		next.ServeHTTP(w, r.WithContext(contextWithAPIClient(r.Context(), c)))
+	})
+}
+
+// RequireScope only lets through API clients whose key grants every one of
+// scopes. It must be mounted after RequireAPIKey.
+func (app *application) RequireScope(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c, ok := apiClientFromContext(r.Context())
+			if !ok {
+				_ = app.errorJSON(w, errors.New("authorization required"), http.StatusUnauthorized)
+				return
+			}
+
+			for _, scope := range scopes {
+				if !slices.Contains(c.Scopes, scope) {
+					_ = app.errorJSON(w, errors.New("this API key does not have access to this resource"), http.StatusForbidden)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireOrganisationMember only lets through staff of the organisation
+// named by the orgID URL parameter and stores their membership in the
+// request context, so a lab's staff can never reach another lab's data. It
+// must be mounted after RequireAuth.
+func (app *application) RequireOrganisationMember(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := principalFromContext(r.Context())
+		if !ok {
+			_ = app.errorJSON(w, errors.New("authorization required"), http.StatusUnauthorized)
+			return
+		}
+
+		orgID, err := readIDParam(r, "orgID")
+		if err != nil {
+			_ = app.errorJSON(w, err, http.StatusBadRequest)
+			return
+		}
+
+		m, err := app.DB.GetOrganisationMembership(p.ID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			_ = app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		if m == nil || m.OrganisationID != orgID {
+			_ = app.errorJSON(w, errors.New("you do not have access to this organisation"), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(contextWithMembership(r.Context(), m)))
+	})
+}
+
+// RequireOrganisationAdmin only lets through the organisation's admins. It
+// must be mounted after RequireOrganisationMember.
+func (app *application) RequireOrganisationAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m, ok := membershipFromContext(r.Context())
+		if !ok || !m.IsAdmin {
+			_ = app.errorJSON(w, errors.New("only organisation admins can do this"), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golangnigeria/liveright_backend/internal/mailer"
+	"github.com/golangnigeria/liveright_backend/internal/models"
+	"github.com/golangnigeria/liveright_backend/internal/repository"
+)
+
+// AllOrganisations lists every partner organisation.
+func (app *application) AllOrganisations(w http.ResponseWriter, r *http.Request) {
+	orgs, err := app.DB.AllOrganisations()
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, JSONResponse{
+		Message: "organisations",
+		Data:    orgs,
+	})
+}
+
+// CreateOrganisation registers a lab, pharmacy or insurer.
+func (app *application) CreateOrganisation(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Name string `json:"name"`
+		Kind string `json:"kind"`
+	}
+
+	if err := app.readJSON(w, r, &payload); err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	org := models.Organisation{
+		Name: strings.TrimSpace(payload.Name),
+		Kind: payload.Kind,
+	}
+
+	if org.Name == "" || len(org.Name) > 200 {
+		_ = app.errorJSON(w, errors.New("name must be 1-200 characters"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if !slices.Contains(models.OrganisationKinds, org.Kind) {
+		_ = app.errorJSON(w, errors.New("kind must be one of "+strings.Join(models.OrganisationKinds, ", ")), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if err := app.DB.InsertOrganisation(&org); err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.auditAdmin(r, models.AuditOrganisationCreated, map[string]any{"organisation_id": org.ID, "name": org.Name, "kind": org.Kind})
+
+	_ = app.writeJSON(w, http.StatusCreated, JSONResponse{
+		Message: "organisation created",
+		Data:    org,
+	})
+}
+
+const invitationTTL = time.Hour * 24 * 7
+
+var errInvalidInvitation = errors.New("invalid or expired invitation")
+
+// OrganisationMembers lists an organisation's staff.
+func (app *application) OrganisationMembers(w http.ResponseWriter, r *http.Request) {
+	org, ok := app.readOrganisationParam(w, r)
+	if !ok {
+		return
+	}
+
+	members, err := app.DB.GetOrganisationMembers(org.ID)
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, JSONResponse{
+		Message: "organisation members",
+		Data:    members,
+	})
+}
+
+// RemoveOrganisationMember removes a member of staff and signs them out
+// everywhere. Their account is deactivated, as it only existed to work for
+// the organisation.
+func (app *application) RemoveOrganisationMember(w http.ResponseWriter, r *http.Request) {
+	org, ok := app.readOrganisationParam(w, r)
+	if !ok {
+		return
+	}
+
+	userID, err := readIDParam(r, "userID")
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if p, ok := principalFromContext(r.Context()); ok && p.ID == userID {
+		_ = app.errorJSON(w, errors.New("you cannot remove yourself from the organisation"), http.StatusConflict)
+		return
+	}
+
+	if err := app.DB.RemoveOrganisationMember(org.ID, userID); err != nil {
+		app.notFoundOrError(w, err, "member not found")
+		return
+	}
+
+	if err := app.DB.RevokeAllRefreshTokens(userID); err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.auditAdmin(r, models.AuditMemberRemoved, map[string]any{"organisation_id": org.ID, "target_user_id": userID})
+
+	_ = app.writeJSON(w, http.StatusOK, JSONResponse{
+		Message: "member removed",
+	})
+}
+
+// OrganisationInvitations lists an organisation's pending invitations.
+func (app *application) OrganisationInvitations(w http.ResponseWriter, r *http.Request) {
+	org, ok := app.readOrganisationParam(w, r)
+	if !ok {
+		return
+	}
+
+	invitations, err := app.DB.GetPendingOrganisationInvitations(org.ID)
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, JSONResponse{
+		Message: "pending invitations",
+		Data:    invitations,
+	})
+}
+
+// InviteOrganisationMember emails an invitation to join an organisation as
+// staff. Staff need an email address of their own, separate from any
+// patient account, because an account holds a single role; an address that
+// is already registered is told so by email and cannot accept.
+func (app *application) InviteOrganisationMember(w http.ResponseWriter, r *http.Request) {
+	org, ok := app.readOrganisationParam(w, r)
+	if !ok {
+		return
+	}
+
+	var payload struct {
+		Email   string `json:"email"`
+		IsAdmin bool   `json:"is_admin"`
+	}
+
+	if err := app.readJSON(w, r, &payload); err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	email := strings.TrimSpace(payload.Email)
+	if _, err := mail.ParseAddress(email); err != nil {
+		_ = app.errorJSON(w, errors.New("a valid email address is required"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	_, err := app.DB.GetUserByEmail(email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	registered := err == nil
+
+	token, err := generateRandomToken()
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	inv := models.OrganisationInvitation{
+		OrganisationID: org.ID,
+		Email:          models.Email(email),
+		IsAdmin:        payload.IsAdmin,
+		TokenHash:      hashToken(token),
+		ExpiresAt:      time.Now().Add(invitationTTL),
+	}
+	if p, ok := principalFromContext(r.Context()); ok {
+		inv.InvitedBy = &p.ID
+	}
+
+	if err := app.DB.InsertOrganisationInvitation(&inv); err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.auditAdmin(r, models.AuditMemberInvited, map[string]any{"organisation_id": org.ID, "email": email, "is_admin": inv.IsAdmin})
+
+	// The response is the same whether or not the address already has an
+	// account, so inviting cannot be used to find out who is registered.
+	// Only the owner of the address learns why they cannot join this way.
+	if registered {
+		app.sendEmail(mailer.Message{
+			To:      email,
+			Subject: "You have been invited to join " + org.Name + " on LiveRight",
+			Body: fmt.Sprintf(
+				"Hello,\n\nYou have been invited to join %s on LiveRight as a member of staff. This email address already has a LiveRight account, and staff need an address of their own, so ask %s to invite a different address.\n\nIf you were not expecting this, you can ignore this email.",
+				org.Name, org.Name,
+			),
+		})
+	} else {
+		app.sendEmail(mailer.Message{
+			To:      email,
+			Subject: "You have been invited to join " + org.Name + " on LiveRight",
+			Body: fmt.Sprintf(
+				"Hello,\n\nYou have been invited to join %s on LiveRight as a member of staff. Open the link below to set up your account. It expires in %d days.\n\n%s\n\nIf you were not expecting this, you can ignore this email.",
+				org.Name, int(invitationTTL.Hours()/24), app.frontendLink("/accept-invitation", token),
+			),
+		})
+	}
+
+	_ = app.writeJSON(w, http.StatusCreated, JSONResponse{
+		Message: "invitation sent",
+		Data:    inv,
+	})
+}
+
+// WithdrawOrganisationInvitation cancels a pending invitation.
+func (app *application) WithdrawOrganisationInvitation(w http.ResponseWriter, r *http.Request) {
+	org, ok := app.readOrganisationParam(w, r)
+	if !ok {
+		return
+	}
+
+	invitationID, err := readIDParam(r, "invitationID")
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := app.DB.DeleteOrganisationInvitation(org.ID, invitationID); err != nil {
+		app.notFoundOrError(w, err, "invitation not found")
+		return
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, JSONResponse{
+		Message: "invitation withdrawn",
+	})
+}
+
+// GetInvitation describes the invitation behind a token, so the client can
+// show which organisation is inviting and to which address.
+func (app *application) GetInvitation(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		_ = app.errorJSON(w, errors.New("token is required"), http.StatusBadRequest)
+		return
+	}
+
+	inv, err := app.DB.GetValidOrganisationInvitation(hashToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			_ = app.errorJSON(w, errInvalidInvitation, http.StatusNotFound)
+			return
+		}
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	org, err := app.DB.GetOrganisationByID(inv.OrganisationID)
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, JSONResponse{
+		Message: "invitation",
+		Data: map[string]any{
+			"organisation": org,
+			"email":        inv.Email,
+			"expires_at":   inv.ExpiresAt,
+		},
+	})
+}
+
+// AcceptInvitation creates the invitee's staff account from an invitation
+// token and signs them in.
+func (app *application) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Token     string `json:"token"`
+		FirstName string `json:"first_name"`
+		LastName  string `json:"last_name"`
+		Password  string `json:"password"`
+		Phone     string `json:"phone,omitempty"`
+	}
+
+	if err := app.readJSON(w, r, &payload); err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// look the invitation up first so the password policy can check the
+	// password against the invited address
+	inv, err := app.DB.GetValidOrganisationInvitation(hashToken(payload.Token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			_ = app.errorJSON(w, errInvalidInvitation, http.StatusBadRequest)
+			return
+		}
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	userPhone, ok := app.normalizePhone(w, payload.Phone)
+	if !ok {
+		return
+	}
+
+	u := &models.User{
+		FirstName: strings.TrimSpace(payload.FirstName),
+		LastName:  strings.TrimSpace(payload.LastName),
+		Email:     inv.Email,
+		Phone:     userPhone,
+	}
+
+	if u.FirstName == "" || u.LastName == "" {
+		_ = app.errorJSON(w, errors.New("first and last name are required"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if !app.checkPasswordPolicy(w, payload.Password, u) {
+		return
+	}
+
+	if err := u.HashPassword(payload.Password, app.hashParams); err != nil {
+		_ = app.errorJSON(w, errors.New("unable to hash password"), http.StatusInternalServerError)
+		return
+	}
+
+	user, err := app.DB.AcceptOrganisationInvitation(hashToken(payload.Token), u)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			_ = app.errorJSON(w, errInvalidInvitation, http.StatusBadRequest)
+		case errors.Is(err, repository.ErrDuplicate):
+			_ = app.errorJSON(w, errors.New("this email address already has a LiveRight account"), http.StatusConflict)
+		default:
+			_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	app.audit(r, &user.ID, models.AuditMemberJoined, map[string]any{"organisation_id": inv.OrganisationID, "is_admin": inv.IsAdmin})
+
+	app.beginLogin(w, r, user)
+}
+
+// OrganisationAPIKeys lists the API keys of the caller's organisation.
+func (app *application) OrganisationAPIKeys(w http.ResponseWriter, r *http.Request) {
+	m, _ := membershipFromContext(r.Context())
+	app.listAPIKeys(w, m.OrganisationID)
+}
+
+// CreateOrganisationAPIKey issues a key to the caller's organisation.
+func (app *application) CreateOrganisationAPIKey(w http.ResponseWriter, r *http.Request) {
+	m, _ := membershipFromContext(r.Context())
+	app.createAPIKey(w, r, m.OrganisationID, models.APIKeyScopes)
+}
+
+// RotateOrganisationAPIKey rotates one of the caller's organisation's keys.
+func (app *application) RotateOrganisationAPIKey(w http.ResponseWriter, r *http.Request) {
+	m, _ := membershipFromContext(r.Context())
+	app.rotateAPIKey(w, r, m.OrganisationID, models.APIKeyScopes)
+}
+
+// RevokeOrganisationAPIKey revokes one of the caller's organisation's keys.
+func (app *application) RevokeOrganisationAPIKey(w http.ResponseWriter, r *http.Request) {
+	m, _ := membershipFromContext(r.Context())
+	app.revokeAPIKey(w, r, m.OrganisationID, models.APIKeyScopes)
+}
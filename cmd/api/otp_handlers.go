@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golangnigeria/liveright_backend/internal/models"
+	"github.com/golangnigeria/liveright_backend/internal/phone"
+	"github.com/golangnigeria/liveright_backend/internal/sms"
+)
+
+// OTPSettings controls phone sign-in codes. Each code lasts TTL and allows
+// MaxAttempts guesses. At most MaxSends codes are sent to one number, and
+// MaxSendsPerIP requested from one client IP, over SendWindow.
+type OTPSettings struct {
+	TTL           time.Duration
+	MaxAttempts   int
+	SendWindow    time.Duration
+	MaxSends      int
+	MaxSendsPerIP int
+}
+
+const (
+	otpDigits  = 6
+	smsTimeout = time.Second * 30
+)
+
+var (
+	errInvalidOTP     = errors.New("invalid or expired code")
+	errTooManyOTPSent = errors.New("too many codes requested, please try again later")
+)
+
+// sendSMS delivers msg in the background, like sendEmail, so responses do
+// not reveal whether a message was sent.
+func (app *application) sendSMS(msg sms.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), smsTimeout)
+		defer cancel()
+
+		if err := app.SMS.Send(ctx, msg); err != nil {
+			log.Printf("sms: unable to send to %s: %v", msg.To, err)
+		}
+	}()
+}
+
+// generateOTP returns a random numeric code of otpDigits digits.
+func generateOTP() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < otpDigits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", otpDigits, n), nil
+}
+
+// RequestOTP texts a sign-in code to a phone number. The response is the
+// same whether or not the number belongs to an account.
+func (app *application) RequestOTP(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Phone string `json:"phone"`
+	}
+
+	if err := app.readJSON(w, r, &payload); err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	number, err := phone.Normalize(payload.Phone)
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	since := time.Now().Add(-app.otpSettings.SendWindow)
+
+	sentToIP, err := app.DB.CountPhoneOTPsByIP(clientIP(r), since)
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	sentToPhone, err := app.DB.CountPhoneOTPs(number, since)
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if sentToIP >= app.otpSettings.MaxSendsPerIP || sentToPhone >= app.otpSettings.MaxSends {
+		w.Header().Set("Retry-After", retryAfter(app.otpSettings.SendWindow))
+		_ = app.errorJSON(w, errTooManyOTPSent, http.StatusTooManyRequests)
+		return
+	}
+
+	users, err := app.DB.GetUsersByPhone(number)
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	code, err := generateOTP()
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	otp := models.PhoneOTP{
+		Phone:     number,
+		CodeHash:  hashToken(code),
+		IPAddress: clientIP(r),
+		ExpiresAt: time.Now().Add(app.otpSettings.TTL),
+	}
+
+	// A number shared by several accounts cannot say which one to sign in
+	// to, so it is treated like a number with no account.
+	if len(users) == 1 {
+		otp.UserID = &users[0].ID
+	}
+
+	// the code is recorded either way so send limits behave the same for
+	// every number
+	if err := app.DB.InsertPhoneOTP(&otp); err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if otp.UserID != nil {
+		app.sendSMS(sms.Message{
+			To: number,
+			Body: fmt.Sprintf(
+				"Your LiveRight sign-in code is %s. It expires in %d minutes. Do not share it with anyone.",
+				code, int(app.otpSettings.TTL.Minutes()),
+			),
+		})
+	}
+
+	_ = app.writeJSON(w, http.StatusAccepted, JSONResponse{
+		Message: "if an account exists for that number, a code has been sent",
+	})
+}
+
+// VerifyOTP exchanges a phone number and the code texted to it for tokens.
+func (app *application) VerifyOTP(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Phone string `json:"phone"`
+		Code  string `json:"code"`
+	}
+
+	if err := app.readJSON(w, r, &payload); err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	number, err := phone.Normalize(payload.Phone)
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// the guess is counted before the code is compared, so parallel
+	// guesses cannot get past MaxAttempts
+	otp, err := app.DB.UsePhoneOTPAttempt(number, app.otpSettings.MaxAttempts)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			_ = app.errorJSON(w, errInvalidOTP, http.StatusUnauthorized)
+			return
+		}
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	code := hashToken(strings.TrimSpace(payload.Code))
+	if otp.UserID == nil || subtle.ConstantTimeCompare(code, otp.CodeHash) != 1 {
+		_ = app.errorJSON(w, errInvalidOTP, http.StatusUnauthorized)
+		return
+	}
+
+	consumed, err := app.DB.ConsumePhoneOTP(otp.ID)
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	if !consumed {
+		_ = app.errorJSON(w, errInvalidOTP, http.StatusUnauthorized)
+		return
+	}
+
+	user, err := app.DB.GetUserByID(*otp.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			_ = app.errorJSON(w, errInvalidOTP, http.StatusUnauthorized)
+			return
+		}
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if !user.Active {
+		_ = app.errorJSON(w, errInvalidOTP, http.StatusUnauthorized)
+		return
+	}
+
+	app.beginLogin(w, r, user)
+}
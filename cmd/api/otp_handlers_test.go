@@ -0,0 +1,242 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golangnigeria/liveright_backend/internal/models"
+	"github.com/golangnigeria/liveright_backend/internal/sms"
+)
+
+func TestGenerateOTP(t *testing.T) {
+	seen := make(map[string]bool)
+
+	for i := 0; i < 200; i++ {
+		code, err := generateOTP()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(code) != otpDigits {
+			t.Fatalf("generateOTP() = %q, want %d digits", code, otpDigits)
+		}
+		for _, r := range code {
+			if r < '0' || r > '9' {
+				t.Fatalf("generateOTP() = %q, want only digits", code)
+			}
+		}
+
+		seen[code] = true
+	}
+
+	// 200 draws from a million codes almost never repeat much; a handful
+	// of distinct codes means the generator is broken
+	if len(seen) < 190 {
+		t.Errorf("generateOTP() gave only %d distinct codes in 200 draws", len(seen))
+	}
+}
+
+const testPhone = "+2348031234567"
+
+var otpPattern = regexp.MustCompile(`\b\d{6}\b`)
+
+// newOTPApp returns an application that texts codes to a FakeSender and
+// whose database holds one patient with a verified testPhone.
+func newOTPApp(t *testing.T) (*application, *stubRepo, *sms.FakeSender) {
+	t.Helper()
+
+	keys, err := NewEphemeralKeySet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := newStubRepo()
+	db.addRole(patientRoleID, models.RolePatient)
+	u := db.addUser(1, patientRoleID)
+	number, verified := testPhone, time.Now()
+	u.Phone, u.PhoneVerifiedAt = &number, &verified
+
+	sender := &sms.FakeSender{}
+	app := &application{
+		DB:  db,
+		SMS: sender,
+		auth: Auth{
+			Issuer:        "liveright.test",
+			Audience:      "liveright.test",
+			Keys:          keys,
+			TokenExpiry:   time.Minute,
+			RefreshExpiry: time.Hour,
+			CookieName:    "refresh_token",
+		},
+		otpSettings: OTPSettings{
+			TTL:           time.Minute * 5,
+			MaxAttempts:   3,
+			SendWindow:    time.Hour,
+			MaxSends:      2,
+			MaxSendsPerIP: 10,
+		},
+	}
+	return app, db, sender
+}
+
+// requestCode asks for a code for testPhone and returns the one texted,
+// waiting for sendSMS to deliver it.
+func requestCode(t *testing.T, app *application, sender *sms.FakeSender) string {
+	t.Helper()
+
+	sent := len(sender.Messages())
+
+	w := serve(t, app.RequestOTP, nil, `{"phone": "0803 123 4567"}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("RequestOTP status = %d, want %d: %s", w.Code, http.StatusAccepted, w.Body)
+	}
+
+	deadline := time.Now().Add(time.Second * 2)
+	for time.Now().Before(deadline) {
+		if len(sender.Messages()) > sent {
+			msg, _ := sender.Last(testPhone)
+			if code := otpPattern.FindString(msg.Body); code != "" {
+				return code
+			}
+			t.Fatalf("no code in message %q", msg.Body)
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+	t.Fatal("no code was texted")
+	return ""
+}
+
+func verifyCode(t *testing.T, app *application, code string) int {
+	t.Helper()
+	return serve(t, app.VerifyOTP, nil, `{"phone": "`+testPhone+`", "code": "`+code+`"}`).Code
+}
+
+// wrongCode returns a code that is not code.
+func wrongCode(code string) string {
+	if code == "000000" {
+		return "111111"
+	}
+	return "000000"
+}
+
+func TestRequestOTPUnknownNumber(t *testing.T) {
+	app, db, sender := newOTPApp(t)
+
+	w := serve(t, app.RequestOTP, nil, `{"phone": "+447911123456"}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusAccepted)
+	}
+
+	// the code still counts towards the send limits but is never texted
+	if len(db.phoneOTPs) != 1 {
+		t.Errorf("stored %d codes, want 1", len(db.phoneOTPs))
+	}
+	time.Sleep(time.Millisecond * 50)
+	if msgs := sender.Messages(); len(msgs) != 0 {
+		t.Errorf("sent %d messages to an unknown number", len(msgs))
+	}
+}
+
+func TestRequestOTPSendLimit(t *testing.T) {
+	app, _, sender := newOTPApp(t)
+
+	for i := 0; i < app.otpSettings.MaxSends; i++ {
+		requestCode(t, app, sender)
+	}
+
+	w := serve(t, app.RequestOTP, nil, `{"phone": "`+testPhone+`"}`)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status after %d sends = %d, want %d", app.otpSettings.MaxSends, w.Code, http.StatusTooManyRequests)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("missing Retry-After header")
+	}
+	if n := len(sender.Messages()); n != app.otpSettings.MaxSends {
+		t.Errorf("sent %d messages, want %d", n, app.otpSettings.MaxSends)
+	}
+}
+
+func TestVerifyOTP(t *testing.T) {
+	app, db, sender := newOTPApp(t)
+	code := requestCode(t, app, sender)
+
+	if got := verifyCode(t, app, wrongCode(code)); got != http.StatusUnauthorized {
+		t.Fatalf("wrong code status = %d, want %d", got, http.StatusUnauthorized)
+	}
+
+	if got := verifyCode(t, app, code); got != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", got, http.StatusAccepted)
+	}
+	if len(db.sessions) != 1 {
+		t.Errorf("created %d sessions, want 1", len(db.sessions))
+	}
+
+	if got := verifyCode(t, app, code); got != http.StatusUnauthorized {
+		t.Errorf("reused code status = %d, want %d", got, http.StatusUnauthorized)
+	}
+}
+
+func TestVerifyOTPAttemptLimit(t *testing.T) {
+	app, _, sender := newOTPApp(t)
+	code := requestCode(t, app, sender)
+
+	for i := 0; i < app.otpSettings.MaxAttempts; i++ {
+		if got := verifyCode(t, app, wrongCode(code)); got != http.StatusUnauthorized {
+			t.Fatalf("guess %d status = %d, want %d", i+1, got, http.StatusUnauthorized)
+		}
+	}
+
+	if got := verifyCode(t, app, code); got != http.StatusUnauthorized {
+		t.Errorf("right code after %d wrong guesses status = %d, want %d",
+			app.otpSettings.MaxAttempts, got, http.StatusUnauthorized)
+	}
+}
+
+func TestVerifyOTPParallelGuesses(t *testing.T) {
+	app, db, sender := newOTPApp(t)
+	code := requestCode(t, app, sender)
+
+	var wg sync.WaitGroup
+	for i := 0; i < app.otpSettings.MaxAttempts*4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			verifyCode(t, app, wrongCode(code))
+		}()
+	}
+	wg.Wait()
+
+	if attempts := db.phoneOTPs[0].Attempts; attempts != app.otpSettings.MaxAttempts {
+		t.Errorf("attempts = %d, want %d", attempts, app.otpSettings.MaxAttempts)
+	}
+	if got := verifyCode(t, app, code); got != http.StatusUnauthorized {
+		t.Errorf("right code after parallel guesses status = %d, want %d", got, http.StatusUnauthorized)
+	}
+}
+
+func TestVerifyOTPExpired(t *testing.T) {
+	app, db, sender := newOTPApp(t)
+	code := requestCode(t, app, sender)
+
+	db.expirePhoneOTPs(testPhone)
+
+	if got := verifyCode(t, app, code); got != http.StatusUnauthorized {
+		t.Errorf("expired code status = %d, want %d", got, http.StatusUnauthorized)
+	}
+}
+
+func TestVerifyOTPEarlierCode(t *testing.T) {
+	app, _, sender := newOTPApp(t)
+	first := requestCode(t, app, sender)
+	second := requestCode(t, app, sender)
+
+	if got := verifyCode(t, app, first); got != http.StatusUnauthorized {
+		t.Errorf("earlier code status = %d, want %d", got, http.StatusUnauthorized)
+	}
+	if got := verifyCode(t, app, second); got != http.StatusAccepted {
+		t.Errorf("latest code status = %d, want %d", got, http.StatusAccepted)
+	}
+}
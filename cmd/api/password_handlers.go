@@ -0,0 +1,303 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golangnigeria/liveright_backend/internal/mailer"
+	"github.com/golangnigeria/liveright_backend/internal/models"
+	"github.com/golangnigeria/liveright_backend/internal/password"
+)
+
+const passwordResetTTL = time.Minute * 30
+
+var errInvalidResetToken = errors.New("invalid or expired reset token")
+
+// dummyPasswords holds throwaway password hashes that sign-in checks
+// unknown emails against, so they cost as much as registered ones. Stored
+// hashes are argon2id or, from before the switch, bcrypt, which take
+// different times to verify, so there is a dummy of each kind, picked in the
+// same proportion as the stored hashes.
+type dummyPasswords struct {
+	argon2id *models.User
+	bcrypt   *models.User
+
+	// bcryptPerMille is how many stored hashes in a thousand are bcrypt.
+	bcryptPerMille int
+}
+
+// newDummyPasswords hashes a random password with each algorithm, using the
+// application's cost parameters, and reads the mix of stored hashes.
+func (app *application) newDummyPasswords() (*dummyPasswords, error) {
+	plain, err := generateRandomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &dummyPasswords{argon2id: &models.User{}, bcrypt: &models.User{}}
+
+	argon2idParams := app.hashParams
+	argon2idParams.Algorithm = password.Argon2id
+	if err := d.argon2id.HashPassword(plain, argon2idParams); err != nil {
+		return nil, err
+	}
+
+	bcryptParams := app.hashParams
+	bcryptParams.Algorithm = password.Bcrypt
+	if err := d.bcrypt.HashPassword(plain, bcryptParams); err != nil {
+		return nil, err
+	}
+
+	argon2idCount, bcryptCount, err := app.DB.CountPasswordHashes()
+	if err != nil {
+		return nil, err
+	}
+
+	switch total := argon2idCount + bcryptCount; {
+	case total > 0:
+		d.bcryptPerMille = bcryptCount * 1000 / total
+	case app.hashParams.Algorithm == password.Bcrypt:
+		d.bcryptPerMille = 1000
+	}
+
+	return d, nil
+}
+
+// forEmail picks the dummy to check an unknown email against. The choice
+// depends only on the email, so asking again takes the same time, and over
+// many emails it follows the mix of stored hashes.
+func (d *dummyPasswords) forEmail(email string) *models.User {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	if int(binary.BigEndian.Uint32(sum[:4])%1000) < d.bcryptPerMille {
+		return d.bcrypt
+	}
+	return d.argon2id
+}
+
+// checkPasswordPolicy validates plain against the password policy for user.
+// When it fails it writes a 422 response listing each broken rule and
+// returns false.
+func (app *application) checkPasswordPolicy(w http.ResponseWriter, plain string, user *models.User) bool {
+	err := app.passwordPolicy.Validate(plain, string(user.Email), user.FirstName, user.LastName)
+	if err == nil {
+		return true
+	}
+
+	var policyErr *password.PolicyError
+	if !errors.As(err, &policyErr) {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return false
+	}
+
+	_ = app.writeJSON(w, http.StatusUnprocessableEntity, JSONResponse{
+		Error:   true,
+		Message: "password does not meet the password policy",
+		Data:    policyErr.Violations,
+	})
+	return false
+}
+
+// ForgotPassword emails a password reset link to the given address. The
+// response is the same whether or not an account exists.
+func (app *application) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Email string `json:"email"`
+	}
+
+	if err := app.readJSON(w, r, &payload); err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := app.DB.GetUserByEmail(payload.Email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err == nil && user.Active {
+		token, err := app.issueUserToken(user.ID, models.TokenPurposePasswordReset, passwordResetTTL)
+		if err != nil {
+			_ = app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		app.sendEmail(mailer.Message{
+			To:      string(user.Email),
+			Subject: "Reset your LiveRight password",
+			Body: fmt.Sprintf(
+				"Hello %s,\n\nUse the link below to choose a new password. It expires in %d minutes and can only be used once.\n\n%s\n\nIf you did not ask for this, you can ignore this email.",
+				user.FirstName, int(passwordResetTTL.Minutes()), app.frontendLink("/reset-password", token),
+			),
+		})
+	}
+
+	_ = app.writeJSON(w, http.StatusAccepted, JSONResponse{
+		Message: "if an account exists for that email, a reset link has been sent",
+	})
+}
+
+// ResetPassword sets a new password using a token from ForgotPassword and
+// ends every existing session for the account.
+func (app *application) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	if err := app.readJSON(w, r, &payload); err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	hash := hashToken(payload.Token)
+
+	token, err := app.DB.GetValidUserToken(hash, models.TokenPurposePasswordReset)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			_ = app.errorJSON(w, errInvalidResetToken, http.StatusBadRequest)
+			return
+		}
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	user, err := app.DB.GetUserByID(token.UserID)
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// check the policy before spending the token so the user can retry
+	if !app.checkPasswordPolicy(w, payload.Password, user) {
+		return
+	}
+
+	if _, err := app.DB.ConsumeUserToken(hash, models.TokenPurposePasswordReset); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			_ = app.errorJSON(w, errInvalidResetToken, http.StatusBadRequest)
+			return
+		}
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := user.HashPassword(payload.Password, app.hashParams); err != nil {
+		_ = app.errorJSON(w, errors.New("unable to hash password"), http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.DB.UpdateUserPassword(user.ID, user.PasswordHash); err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.DB.RevokeAllRefreshTokens(user.ID); err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.audit(r, &user.ID, models.AuditPasswordReset, nil)
+
+	_ = app.writeJSON(w, http.StatusOK, JSONResponse{
+		Message: "password has been reset, please sign in again",
+	})
+}
+
+// confirmPassword checks that plain is the user's current password before a
+// sensitive change. Failures count against the sign-in throttle, so this
+// cannot be used to guess the password. When the check fails it writes a
+// response and returns false.
+func (app *application) confirmPassword(w http.ResponseWriter, r *http.Request, user *models.User, plain string) bool {
+	attempt, ok := app.reserveLoginAttempt(w, r, string(user.Email))
+	if !ok {
+		return false
+	}
+
+	valid, _, err := user.PasswordMatches(plain, app.hashParams)
+	if err == nil && valid {
+		app.releaseLoginAttempt(attempt)
+		return true
+	}
+
+	if err := app.recordLoginFailure(r, string(user.Email), &user.ID); err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return false
+	}
+	_ = app.errorJSON(w, errors.New("current password is incorrect"), http.StatusUnauthorized)
+	return false
+}
+
+// ChangePassword replaces the authenticated user's password. Every other
+// session is signed out; the one making the change stays signed in.
+func (app *application) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+
+	if err := app.readJSON(w, r, &payload); err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	p, ok := principalFromContext(r.Context())
+	if !ok {
+		_ = app.errorJSON(w, errors.New("authorization required"), http.StatusUnauthorized)
+		return
+	}
+
+	user, ok := app.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.confirmPassword(w, r, user, payload.CurrentPassword) {
+		return
+	}
+
+	if payload.NewPassword == payload.CurrentPassword {
+		_ = app.errorJSON(w, errors.New("new password must be different from the current one"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if !app.checkPasswordPolicy(w, payload.NewPassword, user) {
+		return
+	}
+
+	if err := user.HashPassword(payload.NewPassword, app.hashParams); err != nil {
+		_ = app.errorJSON(w, errors.New("unable to hash password"), http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.DB.UpdateUserPassword(user.ID, user.PasswordHash); err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.DB.RevokeOtherRefreshTokens(user.ID, p.SessionID); err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.audit(r, &user.ID, models.AuditPasswordChanged, nil)
+
+	app.sendEmail(mailer.Message{
+		To:      string(user.Email),
+		Subject: "Your LiveRight password was changed",
+		Body: fmt.Sprintf(
+			"Hello %s,\n\nThe password for your LiveRight account was just changed and every other device has been signed out. If this was not you, reset your password straight away:\n\n%s",
+			user.FirstName, strings.TrimRight(app.FrontendURL, "/")+"/forgot-password",
+		),
+	})
+
+	_ = app.writeJSON(w, http.StatusOK, JSONResponse{
+		Message: "password changed, other devices have been signed out",
+	})
+}
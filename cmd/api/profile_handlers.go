@@ -0,0 +1,382 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/golangnigeria/liveright_backend/internal/mailer"
+	"github.com/golangnigeria/liveright_backend/internal/models"
+	"github.com/golangnigeria/liveright_backend/internal/phone"
+	"github.com/golangnigeria/liveright_backend/internal/repository"
+	"github.com/golangnigeria/liveright_backend/internal/sms"
+)
+
+const emailChangeTTL = time.Hour * 24
+
+// currentUser loads the authenticated caller's account, writing an error
+// response when it cannot.
+func (app *application) currentUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	p, ok := principalFromContext(r.Context())
+	if !ok {
+		_ = app.errorJSON(w, errors.New("authorization required"), http.StatusUnauthorized)
+		return nil, false
+	}
+
+	user, err := app.DB.GetUserByID(p.ID)
+	if err != nil {
+		app.notFoundOrError(w, err, "user not found")
+		return nil, false
+	}
+
+	return user, true
+}
+
+// writeUser responds with the user's profile.
+func (app *application) writeUser(w http.ResponseWriter, status int, message string, user *models.User) {
+	dto, err := app.userDTO(user)
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	_ = app.writeJSON(w, status, JSONResponse{
+		Message: message,
+		Data:    dto,
+	})
+}
+
+// GetProfile returns the authenticated user's profile.
+func (app *application) GetProfile(w http.ResponseWriter, r *http.Request) {
+	if user, ok := app.currentUser(w, r); ok {
+		app.writeUser(w, http.StatusOK, "profile", user)
+	}
+}
+
+// UpdateProfile changes the authenticated user's name. Fields left out of
+// the request are kept. The phone number is a sign-in factor, so it is
+// changed through RequestPhoneChange instead.
+func (app *application) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		FirstName *string `json:"first_name"`
+		LastName  *string `json:"last_name"`
+	}
+
+	if err := app.readJSON(w, r, &payload); err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, ok := app.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if payload.FirstName != nil {
+		user.FirstName = strings.TrimSpace(*payload.FirstName)
+	}
+	if payload.LastName != nil {
+		user.LastName = strings.TrimSpace(*payload.LastName)
+	}
+
+	if user.FirstName == "" || len(user.FirstName) > 100 || user.LastName == "" || len(user.LastName) > 100 {
+		_ = app.errorJSON(w, errors.New("first and last name must be 1-100 characters"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if err := app.DB.UpdateUser(user); err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeUser(w, http.StatusOK, "profile updated", user)
+}
+
+// RequestEmailChange starts a change of the authenticated user's email
+// address. Nothing changes until the link sent to the new address is
+// followed, and the old address is told about the request. The response
+// does not say whether the new address is already registered.
+func (app *application) RequestEmailChange(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	if err := app.readJSON(w, r, &payload); err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, ok := app.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.confirmPassword(w, r, user, payload.Password) {
+		return
+	}
+
+	newEmail := strings.TrimSpace(payload.Email)
+	if _, err := mail.ParseAddress(newEmail); err != nil {
+		_ = app.errorJSON(w, errors.New("a valid email address is required"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if strings.EqualFold(newEmail, string(user.Email)) {
+		_ = app.errorJSON(w, errors.New("that is already your email address"), http.StatusConflict)
+		return
+	}
+
+	_, err := app.DB.GetUserByEmail(newEmail)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		token, err := generateRandomToken()
+		if err != nil {
+			_ = app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		err = app.DB.InsertEmailChange(&models.EmailChange{
+			UserID:    user.ID,
+			NewEmail:  models.Email(newEmail),
+			TokenHash: hashToken(token),
+			ExpiresAt: time.Now().Add(emailChangeTTL),
+		})
+		if err != nil {
+			_ = app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		app.sendEmail(mailer.Message{
+			To:      newEmail,
+			Subject: "Confirm your new LiveRight email address",
+			Body: fmt.Sprintf(
+				"Hello %s,\n\nPlease confirm this as the new email address for your LiveRight account by opening the link below. It expires in %d hours.\n\n%s\n\nIf you did not ask for this, you can ignore this email.",
+				user.FirstName, int(emailChangeTTL.Hours()), app.frontendLink("/confirm-email-change", token),
+			),
+		})
+	}
+
+	app.sendEmail(mailer.Message{
+		To:      string(user.Email),
+		Subject: "Your LiveRight email address is being changed",
+		Body: fmt.Sprintf(
+			"Hello %s,\n\nSomeone signed in to your LiveRight account asked to change its email address to %s. If this was not you, reset your password straight away:\n\n%s",
+			user.FirstName, newEmail, strings.TrimRight(app.FrontendURL, "/")+"/forgot-password",
+		),
+	})
+
+	_ = app.writeJSON(w, http.StatusAccepted, JSONResponse{
+		Message: "if that address can be used, a confirmation link has been sent to it",
+	})
+}
+
+// ConfirmEmailChange applies an email change using the token from the
+// link sent to the new address.
+func (app *application) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	plain := r.URL.Query().Get("token")
+	if plain == "" {
+		_ = app.errorJSON(w, errors.New("token is required"), http.StatusBadRequest)
+		return
+	}
+
+	change, err := app.DB.ConfirmEmailChange(hashToken(plain))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			_ = app.errorJSON(w, errors.New("invalid or expired confirmation token"), http.StatusBadRequest)
+		case errors.Is(err, repository.ErrDuplicate):
+			_ = app.errorJSON(w, errors.New("that email address is no longer available"), http.StatusConflict)
+		default:
+			_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	app.audit(r, &change.UserID, models.AuditEmailChanged, map[string]any{"new_email": change.NewEmail})
+
+	_ = app.writeJSON(w, http.StatusOK, JSONResponse{
+		Message: "email address changed, please use it to sign in from now on",
+	})
+}
+
+// RequestPhoneChange texts a code to a new phone number for the
+// authenticated user. The number is saved, and can be used to sign in,
+// only once the code is entered with ConfirmPhoneChange.
+func (app *application) RequestPhoneChange(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Phone    string `json:"phone"`
+		Password string `json:"password"`
+	}
+
+	if err := app.readJSON(w, r, &payload); err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, ok := app.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.confirmPassword(w, r, user, payload.Password) {
+		return
+	}
+
+	number, err := phone.Normalize(payload.Phone)
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if user.Phone != nil && *user.Phone == number && user.PhoneVerified() {
+		_ = app.errorJSON(w, errors.New("that is already your phone number"), http.StatusConflict)
+		return
+	}
+
+	sent, err := app.DB.CountPhoneChanges(user.ID, number, time.Now().Add(-app.otpSettings.SendWindow))
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if sent >= app.otpSettings.MaxSends {
+		w.Header().Set("Retry-After", retryAfter(app.otpSettings.SendWindow))
+		_ = app.errorJSON(w, errTooManyOTPSent, http.StatusTooManyRequests)
+		return
+	}
+
+	code, err := generateOTP()
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	err = app.DB.InsertPhoneChange(&models.PhoneChange{
+		UserID:    user.ID,
+		NewPhone:  number,
+		CodeHash:  hashToken(code),
+		ExpiresAt: time.Now().Add(app.otpSettings.TTL),
+	})
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.sendSMS(sms.Message{
+		To: number,
+		Body: fmt.Sprintf(
+			"Your LiveRight code to confirm this phone number is %s. It expires in %d minutes. Do not share it with anyone.",
+			code, int(app.otpSettings.TTL.Minutes()),
+		),
+	})
+
+	_ = app.writeJSON(w, http.StatusAccepted, JSONResponse{
+		Message: "a code has been sent to the new number",
+	})
+}
+
+// ConfirmPhoneChange saves the number from the authenticated user's
+// pending phone change once the code texted to it is entered.
+func (app *application) ConfirmPhoneChange(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Code string `json:"code"`
+	}
+
+	if err := app.readJSON(w, r, &payload); err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, ok := app.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	// the guess is counted before the code is compared
+	change, err := app.DB.UsePhoneChangeAttempt(user.ID, app.otpSettings.MaxAttempts)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			_ = app.errorJSON(w, errInvalidOTP, http.StatusBadRequest)
+			return
+		}
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	code := hashToken(strings.TrimSpace(payload.Code))
+	if subtle.ConstantTimeCompare(code, change.CodeHash) != 1 {
+		_ = app.errorJSON(w, errInvalidOTP, http.StatusBadRequest)
+		return
+	}
+
+	if err := app.DB.ConfirmPhoneChange(change.ID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			_ = app.errorJSON(w, errInvalidOTP, http.StatusBadRequest)
+			return
+		}
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.audit(r, &user.ID, models.AuditPhoneChanged, nil)
+
+	app.sendEmail(mailer.Message{
+		To:      string(user.Email),
+		Subject: "Your LiveRight phone number was changed",
+		Body: fmt.Sprintf(
+			"Hello %s,\n\nThe phone number on your LiveRight account was just changed. It can now be used to sign in. If this was not you, reset your password straight away:\n\n%s",
+			user.FirstName, strings.TrimRight(app.FrontendURL, "/")+"/forgot-password",
+		),
+	})
+
+	user, ok = app.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	app.writeUser(w, http.StatusOK, "phone number changed", user)
+}
+
+// RemovePhone removes the authenticated user's phone number, which also
+// turns off sign-in by text message.
+func (app *application) RemovePhone(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Password string `json:"password"`
+	}
+
+	if err := app.readJSON(w, r, &payload); err != nil {
+		_ = app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, ok := app.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.confirmPassword(w, r, user, payload.Password) {
+		return
+	}
+
+	if err := app.DB.RemoveUserPhone(user.ID); err != nil {
+		app.notFoundOrError(w, err, "user not found")
+		return
+	}
+
+	app.audit(r, &user.ID, models.AuditPhoneRemoved, nil)
+
+	user.Phone = nil
+	user.PhoneVerifiedAt = nil
+
+	app.writeUser(w, http.StatusOK, "phone number removed", user)
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/golangnigeria/liveright_backend/internal/models"
 )
 
 func (app *application) routes() http.Handler {
@@ -15,7 +16,163 @@ func (app *application) routes() http.Handler {
 	mux.Use(app.enableCORS)
 
 	mux.Get("/", app.Home)
+	mux.Get("/.well-known/jwks.json", app.JWKS)
 	mux.Post("/auth/authenticate", app.Authenticate)
 	mux.Post("/auth/register/patient", app.RegisterPatient)
+	mux.Post("/auth/register/doctor", app.RegisterDoctor)
+	mux.Post("/auth/refresh", app.RefreshToken)
+	mux.Post("/auth/logout", app.Logout)
+	mux.Post("/auth/password/forgot", app.ForgotPassword)
+	mux.Post("/auth/password/reset", app.ResetPassword)
+	mux.Get("/auth/verify-email", app.VerifyEmail)
+	mux.Get("/auth/email-change/confirm", app.ConfirmEmailChange)
+	mux.Post("/auth/mfa/verify", app.VerifyMFA)
+	mux.Post("/auth/otp/request", app.RequestOTP)
+	mux.Post("/auth/otp/verify", app.VerifyOTP)
+	mux.Post("/auth/magic-link", app.RequestMagicLink)
+	mux.Post("/auth/magic-link/verify", app.VerifyMagicLink)
+	mux.Get("/auth/invitations", app.GetInvitation)
+	mux.Post("/auth/invitations/accept", app.AcceptInvitation)
+	mux.Get("/exports/download", app.DownloadDataExport)
+
+	// routes below require a valid access token
+	mux.Group(func(mux chi.Router) {
+		mux.Use(app.RequireAuth)
+
+		mux.Post("/auth/verify-email/resend", app.ResendVerificationEmail)
+		mux.With(app.DenyImpersonation).Post("/auth/logout-all", app.LogoutAll)
+	})
+
+	// routes acting on the authenticated user's own account
+	mux.Route("/me", func(mux chi.Router) {
+		mux.Use(app.RequireAuth)
+
+		mux.Get("/", app.GetProfile)
+		mux.Patch("/", app.UpdateProfile)
+		mux.Get("/sessions", app.ListSessions)
+		mux.Get("/deletion", app.GetAccountDeletion)
+
+		// credential and session changes are not available to admins
+		// impersonating the user
+		mux.Group(func(mux chi.Router) {
+			mux.Use(app.DenyImpersonation)
+
+			mux.Post("/email", app.RequestEmailChange)
+			mux.Post("/password", app.ChangePassword)
+			mux.Post("/phone", app.RequestPhoneChange)
+			mux.Post("/phone/confirm", app.ConfirmPhoneChange)
+			mux.Delete("/phone", app.RemovePhone)
+			mux.Delete("/sessions/{sessionID}", app.RevokeSession)
+
+			mux.Post("/mfa/totp", app.EnrollTOTP)
+			mux.Post("/mfa/totp/confirm", app.ConfirmTOTP)
+			mux.Post("/mfa/totp/disable", app.DisableTOTP)
+
+			mux.Post("/deletion", app.RequestAccountDeletion)
+			mux.Delete("/deletion", app.CancelAccountDeletion)
+
+			// the export is announced by email, so the address must be
+			// the user's own
+			mux.With(app.RequireVerifiedEmail).Post("/export", app.RequestDataExport)
+			mux.With(app.RequireVerifiedEmail).Get("/export/{exportID}", app.GetDataExport)
+		})
+	})
+
+	// admin routes are limited by permission rather than by role name, so
+	// custom roles can be granted a subset of them
+	mux.Route("/admin", func(mux chi.Router) {
+		mux.Use(app.RequireAuth)
+		mux.Use(app.DenyImpersonation)
+		mux.Use(app.RequireVerifiedEmail)
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(app.RequireRole(models.RoleAdmin))
+
+			mux.Post("/users/{userID}/impersonate", app.ImpersonateUser)
+		})
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(app.RequirePermission(models.PermissionManageRoles))
+
+			mux.Get("/roles", app.AllRoles)
+			mux.Post("/roles", app.CreateRole)
+			mux.Get("/permissions", app.AllPermissions)
+			mux.Post("/roles/{roleID}/permissions", app.AttachRolePermission)
+			mux.Delete("/roles/{roleID}/permissions/{permission}", app.DetachRolePermission)
+		})
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(app.RequirePermission(models.PermissionManageUsers))
+
+			mux.Put("/users/{userID}/role", app.AssignUserRole)
+			mux.Post("/users/{userID}/unlock", app.UnlockUser)
+		})
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(app.RequirePermission(models.PermissionReviewDoctors))
+
+			mux.Get("/doctors", app.DoctorApplications)
+			mux.Post("/doctors/{userID}/approve", app.ApproveDoctor)
+			mux.Post("/doctors/{userID}/reject", app.RejectDoctor)
+		})
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(app.RequirePermission(models.PermissionManageOrganisations))
+
+			mux.Get("/organisations", app.AllOrganisations)
+			mux.Post("/organisations", app.CreateOrganisation)
+			mux.Get("/organisations/{orgID}/api-keys", app.AdminListAPIKeys)
+			mux.Post("/organisations/{orgID}/api-keys", app.AdminCreateAPIKey)
+			mux.Post("/organisations/{orgID}/api-keys/{keyID}/rotate", app.AdminRotateAPIKey)
+			mux.Delete("/organisations/{orgID}/api-keys/{keyID}", app.AdminRevokeAPIKey)
+			mux.Get("/organisations/{orgID}/members", app.OrganisationMembers)
+			mux.Delete("/organisations/{orgID}/members/{userID}", app.RemoveOrganisationMember)
+			mux.Get("/organisations/{orgID}/invitations", app.OrganisationInvitations)
+			mux.Post("/organisations/{orgID}/invitations", app.InviteOrganisationMember)
+			mux.Delete("/organisations/{orgID}/invitations/{invitationID}", app.WithdrawOrganisationInvitation)
+		})
+	})
+
+	// organisation routes are limited to the organisation's own staff
+	mux.Route("/organisations/{orgID}", func(mux chi.Router) {
+		mux.Use(app.RequireAuth)
+		mux.Use(app.RequireVerifiedEmail)
+		mux.Use(app.RequireOrganisationMember)
+
+		mux.Get("/members", app.OrganisationMembers)
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(app.RequireOrganisationAdmin)
+			mux.Use(app.DenyImpersonation)
+
+			mux.Delete("/members/{userID}", app.RemoveOrganisationMember)
+			mux.Get("/invitations", app.OrganisationInvitations)
+			mux.Post("/invitations", app.InviteOrganisationMember)
+			mux.Delete("/invitations/{invitationID}", app.WithdrawOrganisationInvitation)
+
+			mux.Get("/api-keys", app.OrganisationAPIKeys)
+			mux.Post("/api-keys", app.CreateOrganisationAPIKey)
+			mux.Post("/api-keys/{keyID}/rotate", app.RotateOrganisationAPIKey)
+			mux.Delete("/api-keys/{keyID}", app.RevokeOrganisationAPIKey)
+		})
+	})
+
+	// partner routes are called by lab, pharmacy and insurer systems with
+	// an API key rather than a user's access token. Keys are only issued
+	// through the routes above, which need a verified email, so there is
+	// no address to check here.
+	mux.Route("/partner", func(mux chi.Router) {
+		mux.Use(app.RequireAPIKey)
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(app.RequireScope(models.ScopeAPIKeysManage))
+
+			mux.Get("/api-keys", app.PartnerListAPIKeys)
+			mux.Post("/api-keys", app.PartnerCreateAPIKey)
+			mux.Post("/api-keys/{keyID}/rotate", app.PartnerRotateAPIKey)
+			mux.Delete("/api-keys/{keyID}", app.PartnerRevokeAPIKey)
+		})
+	})
+
 	return mux
 }
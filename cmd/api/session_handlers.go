@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golangnigeria/liveright_backend/internal/models"
+)
+
+// ListSessions returns the devices the authenticated user is signed in on,
+// marking the one making the request.
+func (app *application) ListSessions(w http.ResponseWriter, r *http.Request) {
+	p, ok := principalFromContext(r.Context())
+	if !ok {
+		_ = app.errorJSON(w, errors.New("authorization required"), http.StatusUnauthorized)
+		return
+	}
+
+	sessions, err := app.DB.GetSessionsForUser(p.ID)
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if sessions == nil {
+		sessions = []*models.Session{}
+	}
+
+	for _, s := range sessions {
+		s.Current = s.ID == p.SessionID
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, JSONResponse{
+		Message: "active sessions",
+		Data:    sessions,
+	})
+}
+
+// RevokeSession signs the authenticated user out of one device. Access
+// tokens already issued to that device stay valid until they expire, but
+// it can no longer refresh them.
+func (app *application) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	p, ok := principalFromContext(r.Context())
+	if !ok {
+		_ = app.errorJSON(w, errors.New("authorization required"), http.StatusUnauthorized)
+		return
+	}
+
+	sessionID := chi.URLParam(r, "sessionID")
+
+	if err := app.DB.RevokeSession(p.ID, sessionID); err != nil {
+		app.notFoundOrError(w, err, "session not found")
+		return
+	}
+
+	if sessionID == p.SessionID {
+		http.SetCookie(w, app.auth.GetExpiredRefreshToken())
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, JSONResponse{
+		Message: "session revoked",
+	})
+}
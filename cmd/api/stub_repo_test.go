@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golangnigeria/liveright_backend/internal/models"
+	"github.com/golangnigeria/liveright_backend/internal/repository"
+)
+
+// stubRepo is an in-memory stand-in for the database in handler tests. It
+// implements the methods the tested handlers use; calling any other panics
+// on the nil embedded interface, which shows up as a test failure.
+type stubRepo struct {
+	repository.DatabaseRepo
+
+	mu sync.Mutex
+
+	users           map[int64]*models.User
+	roles           map[int64]*models.Role
+	rolePermissions map[int64][]string
+	audit           []models.AuditEntry
+	phoneOTPs       []*models.PhoneOTP
+	sessions        []models.Session
+}
+
+func newStubRepo() *stubRepo {
+	return &stubRepo{
+		users:           make(map[int64]*models.User),
+		roles:           make(map[int64]*models.Role),
+		rolePermissions: make(map[int64][]string),
+	}
+}
+
+// addRole stores a role granting permissions.
+func (s *stubRepo) addRole(id int64, name string, permissions ...string) {
+	s.roles[id] = &models.Role{ID: id, Name: name}
+	s.rolePermissions[id] = permissions
+}
+
+// addUser stores an active user with the given role.
+func (s *stubRepo) addUser(id, roleID int64) *models.User {
+	u := &models.User{
+		ID:     id,
+		Email:  models.Email("user" + formatID(id) + "@example.com"),
+		RoleID: *s.roles[roleID],
+		Active: true,
+	}
+	s.users[id] = u
+	return u
+}
+
+func (s *stubRepo) GetUserByID(id int64) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *u
+	return &copied, nil
+}
+
+func (s *stubRepo) GetRoleByID(id int64) (*models.Role, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	role, ok := s.roles[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return role, nil
+}
+
+func (s *stubRepo) UpdateUserRole(userID, roleID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	u.RoleID = *s.roles[roleID]
+	return nil
+}
+
+func (s *stubRepo) GetPermissionsForRole(roleID int64) ([]*models.Permission, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var permissions []*models.Permission
+	for _, name := range s.rolePermissions[roleID] {
+		permissions = append(permissions, &models.Permission{Name: name})
+	}
+	return permissions, nil
+}
+
+func (s *stubRepo) AttachPermissionToRole(roleID int64, permission string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !slices.Contains(s.rolePermissions[roleID], permission) {
+		s.rolePermissions[roleID] = append(s.rolePermissions[roleID], permission)
+	}
+	return nil
+}
+
+func (s *stubRepo) InsertAuditEntry(entry *models.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.audit = append(s.audit, *entry)
+	return nil
+}
+
+func (s *stubRepo) GetUsersByPhone(phone string) ([]*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var users []*models.User
+	for _, u := range s.users {
+		if u.Phone != nil && *u.Phone == phone && u.PhoneVerified() && u.Active {
+			copied := *u
+			users = append(users, &copied)
+		}
+	}
+	return users, nil
+}
+
+func (s *stubRepo) InsertPhoneOTP(otp *models.PhoneOTP) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, o := range s.phoneOTPs {
+		if o.Phone == otp.Phone && o.UsedAt == nil {
+			o.UsedAt = &now
+		}
+	}
+
+	otp.ID = int64(len(s.phoneOTPs) + 1)
+	otp.CreatedAt = now
+	copied := *otp
+	s.phoneOTPs = append(s.phoneOTPs, &copied)
+	return nil
+}
+
+func (s *stubRepo) CountPhoneOTPs(phone string, since time.Time) (int, error) {
+	return s.countPhoneOTPs(func(o *models.PhoneOTP) bool { return o.Phone == phone }, since), nil
+}
+
+func (s *stubRepo) CountPhoneOTPsByIP(ip string, since time.Time) (int, error) {
+	return s.countPhoneOTPs(func(o *models.PhoneOTP) bool { return o.IPAddress == ip }, since), nil
+}
+
+func (s *stubRepo) countPhoneOTPs(match func(*models.PhoneOTP) bool, since time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, o := range s.phoneOTPs {
+		if match(o) && o.CreatedAt.After(since) {
+			count++
+		}
+	}
+	return count
+}
+
+// UsePhoneOTPAttempt follows the Postgres query: only the latest unused,
+// unexpired code for phone can be guessed, and only while it has attempts
+// left.
+func (s *stubRepo) UsePhoneOTPAttempt(phone string, maxAttempts int) (*models.PhoneOTP, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := len(s.phoneOTPs) - 1; i >= 0; i-- {
+		o := s.phoneOTPs[i]
+		if o.Phone != phone || o.UsedAt != nil || !o.ExpiresAt.After(time.Now()) {
+			continue
+		}
+		if o.Attempts >= maxAttempts {
+			return nil, sql.ErrNoRows
+		}
+		o.Attempts++
+		copied := *o
+		return &copied, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *stubRepo) ConsumePhoneOTP(id int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, o := range s.phoneOTPs {
+		if o.ID == id && o.UsedAt == nil && o.ExpiresAt.After(time.Now()) {
+			now := time.Now()
+			o.UsedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// expirePhoneOTPs moves the expiry of every code for phone into the past.
+func (s *stubRepo) expirePhoneOTPs(phone string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, o := range s.phoneOTPs {
+		if o.Phone == phone {
+			o.ExpiresAt = time.Now().Add(-time.Second)
+		}
+	}
+}
+
+func (s *stubRepo) GetTOTP(userID int64) (*models.TOTP, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (s *stubRepo) ClearLoginFailures(email string) error {
+	return nil
+}
+
+func (s *stubRepo) InsertSession(session *models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions = append(s.sessions, *session)
+	return nil
+}
+
+func (s *stubRepo) InsertRefreshToken(token *models.RefreshToken) error {
+	return nil
+}
+
+// serve calls handler with a JSON body, as the principal p when it is not
+// nil, and with the given chi URL parameters as name, value pairs.
+func serve(t *testing.T, handler http.HandlerFunc, p *Principal, body string, params ...string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+	r.Header.Set("Content-Type", "application/json")
+
+	rctx := chi.NewRouteContext()
+	for i := 0; i+1 < len(params); i += 2 {
+		rctx.URLParams.Add(params[i], params[i+1])
+	}
+	ctx := r.Context()
+	ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+	if p != nil {
+		ctx = contextWithPrincipal(ctx, p)
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, r.WithContext(ctx))
+	return w
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golangnigeria/liveright_backend/internal/models"
+)
+
+// LoginThrottle limits password guessing. Failed attempts are counted per
+// account and per client IP over Window. After FreeAttempts failures each
+// further attempt on the account must wait twice as long as the last,
+// up to MaxDelay, and LockThreshold failures lock the account for
+// LockDuration.
+type LoginThrottle struct {
+	Window        time.Duration
+	FreeAttempts  int
+	MaxDelay      time.Duration
+	LockThreshold int
+	LockDuration  time.Duration
+	MaxPerIP      int
+}
+
+// delay returns how long an account with the given number of recent
+// failures must wait after its latest failure before trying again.
+func (t LoginThrottle) delay(failures int) time.Duration {
+	if failures < t.FreeAttempts {
+		return 0
+	}
+
+	d := time.Second * time.Duration(math.Pow(2, float64(failures-t.FreeAttempts)))
+	if d > t.MaxDelay || d <= 0 {
+		return t.MaxDelay
+	}
+	return d
+}
+
+var (
+	errTooManyAttempts = errors.New("too many sign-in attempts, please try again later")
+	errAccountLocked   = errors.New("account temporarily locked after repeated failed sign-in attempts")
+)
+
+// reserveLoginAttempt enforces the login throttle before any password or
+// code is checked. The attempt is stored as a failure up front, so
+// concurrent guesses all count against the limits; releaseLoginAttempt
+// takes it back once the attempt succeeds. When the attempt is not allowed
+// it writes a 429 or 423 response and returns false.
+func (app *application) reserveLoginAttempt(w http.ResponseWriter, r *http.Request, email string) (attemptID int64, ok bool) {
+	now := time.Now()
+
+	lockedUntil, err := app.DB.GetAccountLockout(email)
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return 0, false
+	}
+
+	if lockedUntil != nil {
+		w.Header().Set("Retry-After", retryAfter(lockedUntil.Sub(now)))
+		_ = app.errorJSON(w, errAccountLocked, http.StatusLocked)
+		return 0, false
+	}
+
+	attempt, err := app.DB.ReserveLoginAttempt(email, clientIP(r), now.Add(-app.loginThrottle.Window))
+	if err != nil {
+		_ = app.errorJSON(w, err, http.StatusInternalServerError)
+		return 0, false
+	}
+
+	// failures made before this attempt
+	earlier := attempt.Failures - 1
+
+	var status int
+	var refusal error
+	var wait time.Duration
+
+	switch {
+	case attempt.IPFailures > app.loginThrottle.MaxPerIP:
+		status, refusal, wait = http.StatusTooManyRequests, errTooManyAttempts, app.loginThrottle.Window
+	case earlier >= app.loginThrottle.LockThreshold:
+		// the lock is still being written by a concurrent attempt
+		status, refusal, wait = http.StatusLocked, errAccountLocked, app.loginThrottle.LockDuration
+	default:
+		wait = attempt.LastFailure.Add(app.loginThrottle.delay(earlier)).Sub(now)
+		if wait > 0 {
+			status, refusal = http.StatusTooManyRequests, errTooManyAttempts
+		}
+	}
+
+	if refusal != nil {
+		// a refused attempt checks nothing, so it is not a failure
+		app.releaseLoginAttempt(attempt.ID)
+		w.Header().Set("Retry-After", retryAfter(wait))
+		_ = app.errorJSON(w, refusal, status)
+		return 0, false
+	}
+
+	return attempt.ID, true
+}
+
+// releaseLoginAttempt takes back an attempt reserved by
+// reserveLoginAttempt that succeeded. Failures are logged; at worst the
+// attempt counts as a failure.
+func (app *application) releaseLoginAttempt(attemptID int64) {
+	if err := app.DB.ReleaseLoginAttempt(attemptID); err != nil {
+		log.Printf("login throttle: unable to release attempt %d: %v", attemptID, err)
+	}
+}
+
+// recordLoginFailure keeps a reserved attempt as a failure against email
+// and locks the account once the threshold is reached.
+func (app *application) recordLoginFailure(r *http.Request, email string, userID *int64) error {
+	failures, _, err := app.DB.CountLoginFailures(email, time.Now().Add(-app.loginThrottle.Window))
+	if err != nil {
+		return err
+	}
+
+	if failures >= app.loginThrottle.LockThreshold {
+		until := time.Now().Add(app.loginThrottle.LockDuration)
+		if err := app.DB.LockAccount(email, until); err != nil {
+			return err
+		}
+
+		app.audit(r, userID, models.AuditAccountLocked, map[string]any{
+			"email":        email,
+			"failures":     failures,
+			"locked_until": until,
+		})
+	}
+
+	return nil
+}
+
+// retryAfter formats d as a Retry-After header value in whole seconds.
+func retryAfter(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/golangnigeria/liveright_backend/internal/models"
+)
+
+var errInvalidRefreshToken = errors.New("invalid refresh token")
+
+// maxUserAgentLength caps the user agent stored with each session.
+const maxUserAgentLength = 512
+
+// issueTokens generates a token pair for user, records the refresh token
+// server-side and sets the refresh token cookie. An empty familyID starts a
+// new session and refresh token family, as happens on sign-in; rotations
+// pass the family of the token being replaced.
+func (app *application) issueTokens(w http.ResponseWriter, r *http.Request, user *models.User, familyID string) (TokenPairs, error) {
+	userAgent := truncate(r.UserAgent(), maxUserAgentLength)
+
+	if familyID == "" {
+		id, err := generateRandomToken()
+		if err != nil {
+			return TokenPairs{}, err
+		}
+		familyID = id
+
+		err = app.DB.InsertSession(&models.Session{
+			ID:        familyID,
+			UserID:    user.ID,
+			UserAgent: userAgent,
+			IPAddress: clientIP(r),
+		})
+		if err != nil {
+			return TokenPairs{}, err
+		}
+	} else {
+		if err := app.DB.TouchSession(familyID, clientIP(r), userAgent); err != nil {
+			return TokenPairs{}, err
+		}
+	}
+
+	role, err := app.DB.GetRoleByID(user.RoleID.ID)
+	if err != nil {
+		return TokenPairs{}, fmt.Errorf("loading role: %w", err)
+	}
+
+	u := jwtUser{
+		ID:        user.ID,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Role:      role.Name,
+
+		EmailVerified: user.EmailVerified(),
+		SessionID:     familyID,
+	}
+
+	tokens, err := app.auth.GenerateTokenPair(&u)
+	if err != nil {
+		return TokenPairs{}, err
+	}
+
+	err = app.DB.InsertRefreshToken(&models.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(tokens.RefreshTokenID),
+		ExpiresAt: tokens.RefreshExpiresAt,
+	})
+	if err != nil {
+		return TokenPairs{}, err
+	}
+
+	http.SetCookie(w, app.auth.GetRefreshToken(tokens.RefreshToken))
+
+	return tokens, nil
+}
+
+// issueUserToken creates a single-use token for purpose that expires after
+// ttl, replacing any the user already holds for the same purpose. The plain
+// token is returned for delivery to the user; only its hash is stored.
+func (app *application) issueUserToken(userID int64, purpose string, ttl time.Duration) (string, error) {
+	if err := app.DB.DeleteUserTokens(userID, purpose); err != nil {
+		return "", err
+	}
+
+	token, err := generateRandomToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = app.DB.InsertUserToken(&models.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// lookupRefreshToken reads the refresh token cookie, verifies its signature
+// and returns the matching server-side record, whatever its state.
+func (app *application) lookupRefreshToken(r *http.Request) (*models.RefreshToken, error) {
+	cookie, err := r.Cookie(app.auth.CookieName)
+	if err != nil {
+		return nil, errInvalidRefreshToken
+	}
+
+	claims, err := app.auth.ParseRefreshToken(cookie.Value)
+	if err != nil {
+		return nil, errInvalidRefreshToken
+	}
+
+	stored, err := app.DB.GetRefreshTokenByHash(hashToken(claims.ID))
+	if err != nil || claims.Subject != formatID(stored.UserID) {
+		return nil, errInvalidRefreshToken
+	}
+
+	return stored, nil
+}
+
+// handleRefreshTokenReuse is called when a refresh token that has already
+// been rotated is presented again. Only one party can legitimately hold the
+// latest token in a family, so reuse means the token was stolen: the whole
+// family is revoked and the event is recorded.
+func (app *application) handleRefreshTokenReuse(r *http.Request, stored *models.RefreshToken) error {
+	if err := app.DB.RevokeRefreshTokenFamily(stored.FamilyID); err != nil {
+		return err
+	}
+
+	app.audit(r, &stored.UserID, models.AuditRefreshTokenReuse, map[string]any{
+		"family_id": stored.FamilyID,
+		"token_id":  stored.ID,
+	})
+
+	return nil
+}
+
+// audit records an entry in the audit log. Failures are logged rather than
+// returned so that auditing never blocks the request being audited.
+func (app *application) audit(r *http.Request, userID *int64, action string, metadata map[string]any) {
+	entry := models.AuditEntry{
+		UserID:    userID,
+		Action:    action,
+		IPAddress: clientIP(r),
+		UserAgent: r.UserAgent(),
+		Metadata:  metadata,
+	}
+
+	if err := app.DB.InsertAuditEntry(&entry); err != nil {
+		log.Printf("audit: unable to record %s: %v", action, err)
+	}
+}
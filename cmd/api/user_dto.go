@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golangnigeria/liveright_backend/internal/models"
+)
+
+// UserDTO is how a user account is shown in API responses. Every handler
+// that returns a user uses it, so clients see the same shape everywhere.
+type UserDTO struct {
+	ID            int64        `json:"id"`
+	FirstName     string       `json:"first_name"`
+	LastName      string       `json:"last_name"`
+	Name          string       `json:"name"`
+	Email         models.Email `json:"email"`
+	Phone         *string      `json:"phone,omitempty"`
+	Role          string       `json:"role"`
+	Active        bool         `json:"active"`
+	EmailVerified bool         `json:"email_verified"`
+	PhoneVerified bool         `json:"phone_verified"`
+	CreatedAt     time.Time    `json:"created_at"`
+}
+
+// newUserDTO builds the response form of user, whose role is named role.
+func newUserDTO(user *models.User, role string) UserDTO {
+	return UserDTO{
+		ID:            user.ID,
+		FirstName:     user.FirstName,
+		LastName:      user.LastName,
+		Name:          user.FirstName + " " + user.LastName,
+		Email:         user.Email,
+		Phone:         user.Phone,
+		Role:          role,
+		Active:        user.Active,
+		EmailVerified: user.EmailVerified(),
+		PhoneVerified: user.PhoneVerified(),
+		CreatedAt:     user.CreatedAt,
+	}
+}
+
+// userDTO looks up the user's role and builds their response form.
+func (app *application) userDTO(user *models.User) (UserDTO, error) {
+	role, err := app.DB.GetRoleByID(user.RoleID.ID)
+	if err != nil {
+		return UserDTO{}, fmt.Errorf("loading role: %w", err)
+	}
+	return newUserDTO(user, role.Name), nil
+}
@@ -5,7 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
 )
 
 type JSONResponse struct {
@@ -76,3 +81,37 @@ func (app *application) errorJSON(w http.ResponseWriter, err error, status ...in
 
 	return app.writeJSON(w, statusCode, payload)
 }
+
+// formatID renders a database ID the way it appears in token subjects.
+func formatID(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
+
+// clientIP returns the IP address of the peer that sent the request.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// readIDParam parses the named URL parameter as a database ID.
+func readIDParam(r *http.Request, name string) (int64, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, name), 10, 64)
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("invalid %s parameter", name)
+	}
+	return id, nil
+}
+
+// truncate shortens s to at most n bytes without splitting a UTF-8 sequence.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
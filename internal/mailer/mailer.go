@@ -0,0 +1,70 @@
+// Package mailer defines how the application sends email. Handlers depend
+// only on the Mailer interface so the delivery mechanism can be swapped
+// between local development and production.
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email messages.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogMailer writes messages to a logger instead of sending them. It is
+// intended for local development, where links in the message can be copied
+// straight out of the server log.
+type LogMailer struct {
+	Logger *log.Logger
+}
+
+// Send logs msg.
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	logger := m.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	logger.Printf("mail to=%q subject=%q\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileMailer writes each message to its own .eml file in Dir instead of
+// sending it, so messages can be opened in a mail client during local
+// development.
+type FileMailer struct {
+	Dir string
+}
+
+// Send writes msg to a new file in m.Dir.
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	if err := os.MkdirAll(m.Dir, 0o700); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(m.Dir, time.Now().UTC().Format("20060102T150405")+"-*.eml")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(f,
+		"To: %s\r\nSubject: %s\r\nDate: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n",
+		msg.To, msg.Subject, time.Now().Format(time.RFC1123Z), msg.Body,
+	)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -5,18 +5,37 @@ package models
 
 import "time"
 
+// Review states of a doctor's application.
+const (
+	DoctorStatusPending  = "pending"
+	DoctorStatusApproved = "approved"
+	DoctorStatusRejected = "rejected"
+)
+
 // Doctor represents a medical professional with personal details,
 // specialization info, and profile metadata used across the application.
+// ID is the doctor's user ID. A doctor can only sign in once an admin has
+// approved their application after checking the MDCN licence number.
 type Doctor struct {
-	ID                int64     `json:"id"`
-	FirstName         string    `json:"first_name"`
-	LastName          string    `json:"last_name"`
-	Email             string    `json:"email"`
-	Phone             string    `json:"phone"`
-	Specialization    string    `json:"specialization"`
-	YearsOfExperience int       `json:"years_of_experience"`
-	Bio               string    `json:"bio"`
-	ProfileImage      string    `json:"profile_image"`
-	CreatedAt         time.Time `json:"-"`
-	UpdatedAt         time.Time `json:"-"`
+	ID                int64      `json:"id"`
+	FirstName         string     `json:"first_name"`
+	LastName          string     `json:"last_name"`
+	Email             string     `json:"email"`
+	Phone             string     `json:"phone"`
+	Specialization    string     `json:"specialization"`
+	YearsOfExperience int        `json:"years_of_experience"`
+	Bio               string     `json:"bio"`
+	ProfileImage      string     `json:"profile_image"`
+	LicenceNumber     string     `json:"licence_number"`
+	Status            string     `json:"status"`
+	RejectionReason   *string    `json:"rejection_reason,omitempty"`
+	ReviewedBy        *int64     `json:"reviewed_by,omitempty"`
+	ReviewedAt        *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt         time.Time  `json:"-"`
+	UpdatedAt         time.Time  `json:"-"`
+}
+
+// Approved reports whether the doctor may sign in and practise.
+func (d *Doctor) Approved() bool {
+	return d.Status == DoctorStatusApproved
 }
@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// Audit log actions recorded by the application.
+const (
+	AuditRefreshTokenReuse   = "refresh_token_reuse"
+	AuditPasswordReset       = "password_reset"
+	AuditPasswordChanged     = "password_changed"
+	AuditEmailVerified       = "email_verified"
+	AuditAccountLocked       = "account_locked"
+	AuditAccountUnlocked     = "account_unlocked"
+	AuditMFAEnabled          = "mfa_enabled"
+	AuditMFADisabled         = "mfa_disabled"
+	AuditRecoveryCodeUsed    = "mfa_recovery_code_used"
+	AuditRoleCreated         = "role_created"
+	AuditRolePermissionsSet  = "role_permissions_changed"
+	AuditUserRoleAssigned    = "user_role_assigned"
+	AuditOrganisationCreated = "organisation_created"
+	AuditAPIKeyCreated       = "api_key_created"
+	AuditAPIKeyRotated       = "api_key_rotated"
+	AuditAPIKeyRevoked       = "api_key_revoked"
+	AuditDoctorApproved      = "doctor_approved"
+	AuditDoctorRejected      = "doctor_rejected"
+	AuditMemberInvited       = "organisation_member_invited"
+	AuditMemberJoined        = "organisation_member_joined"
+	AuditMemberRemoved       = "organisation_member_removed"
+	AuditImpersonationStart  = "impersonation_started"
+	AuditImpersonatedRequest = "impersonated_request"
+	AuditEmailChanged        = "email_changed"
+	AuditPhoneChanged        = "phone_changed"
+	AuditPhoneRemoved        = "phone_removed"
+	AuditDeletionRequested   = "account_deletion_requested"
+	AuditDeletionCancelled   = "account_deletion_cancelled"
+	AuditAccountDeleted      = "account_deleted"
+	AuditDataExportRequested = "data_export_requested"
+	AuditDataExportDownload  = "data_export_downloaded"
+)
+
+// AuditEntry is a single row of the audit log. Security events and other
+// noteworthy account activity are recorded here.
+type AuditEntry struct {
+	ID        int64          `json:"id" db:"id"`
+	UserID    *int64         `json:"user_id,omitempty" db:"user_id"`
+	Action    string         `json:"action" db:"action"`
+	IPAddress string         `json:"ip_address,omitempty" db:"ip_address"`
+	UserAgent string         `json:"user_agent,omitempty" db:"user_agent"`
+	Metadata  map[string]any `json:"metadata,omitempty" db:"metadata"`
+	CreatedAt time.Time      `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// AccountDeletion is a user's request to erase their account. The account
+// stays usable until ScheduledFor so the request can be cancelled; after
+// that its identifying data is anonymised and CertificateID names the
+// audit log entry that records the erasure.
+type AccountDeletion struct {
+	ID            int64      `json:"id" db:"id"`
+	UserID        int64      `json:"user_id" db:"user_id"`
+	RequestedAt   time.Time  `json:"requested_at" db:"requested_at"`
+	ScheduledFor  time.Time  `json:"scheduled_for" db:"scheduled_for"`
+	CancelledAt   *time.Time `json:"cancelled_at,omitempty" db:"cancelled_at"`
+	CompletedAt   *time.Time `json:"completed_at,omitempty" db:"completed_at"`
+	CertificateID *string    `json:"certificate_id,omitempty" db:"certificate_id"`
+}
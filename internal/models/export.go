@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Data export states.
+const (
+	DataExportPending = "pending"
+	DataExportReady   = "ready"
+	DataExportFailed  = "failed"
+	DataExportExpired = "expired"
+)
+
+// DataExport is a copy of a user's personal data, prepared in the
+// background as a zip archive of JSON files. The archive is kept until
+// ExpiresAt and is downloaded through short-lived links; only a SHA-256
+// hash of the current link's token is stored.
+type DataExport struct {
+	ID                int64      `json:"id" db:"id"`
+	UserID            int64      `json:"user_id" db:"user_id"`
+	Status            string     `json:"status" db:"status"`
+	Archive           []byte     `json:"-" db:"archive"`
+	DownloadTokenHash []byte     `json:"-" db:"download_token_hash"`
+	DownloadExpiresAt *time.Time `json:"-" db:"download_expires_at"`
+	RequestedAt       time.Time  `json:"requested_at" db:"requested_at"`
+	CompletedAt       *time.Time `json:"completed_at,omitempty" db:"completed_at"`
+	ExpiresAt         *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+}
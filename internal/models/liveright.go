@@ -50,12 +50,13 @@ type Transaction struct {
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
 
-// Lab facility
+// Lab facility, run by a lab Organisation whose staff manage it
 type Lab struct {
-	ID        int64     `json:"id" db:"id"`
-	Name      string    `json:"name" db:"name"`
-	Address   *string   `json:"address,omitempty" db:"address"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	ID             int64     `json:"id" db:"id"`
+	OrganisationID int64     `json:"organisation_id" db:"organisation_id"`
+	Name           string    `json:"name" db:"name"`
+	Address        *string   `json:"address,omitempty" db:"address"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
 }
 
 // LabTest ordered for a patient
@@ -69,19 +70,21 @@ type LabTest struct {
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
 
-// Pharmacy for the list of approved onces
+// Pharmacy for the list of approved onces, run by a pharmacy Organisation
 type Pharmacy struct {
-	ID        int64     `json:"id" db:"id"`
-	Name      string    `json:"name" db:"name"`
-	Address   *string   `json:"address,omitempty" db:"address"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	ID             int64     `json:"id" db:"id"`
+	OrganisationID int64     `json:"organisation_id" db:"organisation_id"`
+	Name           string    `json:"name" db:"name"`
+	Address        *string   `json:"address,omitempty" db:"address"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
 }
 
-// Insurer (insurance provider)
+// Insurer (insurance provider), backed by an insurance Organisation
 type Insurer struct {
-	ID        int64     `json:"id" db:"id"`
-	Name      string    `json:"name" db:"name"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	ID             int64     `json:"id" db:"id"`
+	OrganisationID int64     `json:"organisation_id" db:"organisation_id"`
+	Name           string    `json:"name" db:"name"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
 }
 
 // InsuranceClaim for those Patient that have it
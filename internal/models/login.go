@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// LoginAttempt is a sign-in attempt reserved before the password or code is
+// checked. It is stored as a failure straight away and only removed once
+// the attempt succeeds, so concurrent guesses are all counted. Failures
+// and IPFailures include this attempt; LastFailure is the latest failure
+// before it.
+type LoginAttempt struct {
+	ID          int64
+	Failures    int
+	LastFailure time.Time
+	IPFailures  int
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// TOTP is a user's authenticator app enrollment. It only protects sign-in
+// once ConfirmedAt is set, which happens after the user proves their app
+// produces valid codes.
+type TOTP struct {
+	UserID       int64      `json:"user_id" db:"user_id"`
+	Secret       []byte     `json:"-" db:"secret"`
+	ConfirmedAt  *time.Time `json:"confirmed_at,omitempty" db:"confirmed_at"`
+	LastUsedStep int64      `json:"-" db:"last_used_step"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+}
+
+// Enabled reports whether the enrollment has been confirmed.
+func (t *TOTP) Enabled() bool {
+	return t.ConfirmedAt != nil
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// Kinds of partner organisation. Each matches the name of the role its
+// staff hold.
+const (
+	OrganisationLab       = RoleLab
+	OrganisationPharmacy  = RolePharmacy
+	OrganisationInsurance = RoleInsurance
+)
+
+// OrganisationKinds lists every valid Organisation.Kind.
+var OrganisationKinds = []string{OrganisationLab, OrganisationPharmacy, OrganisationInsurance}
+
+// Organisation is a partner business, such as a lab, pharmacy or insurer,
+// that accesses the platform on behalf of its customers.
+type Organisation struct {
+	ID        int64     `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	Kind      string    `json:"kind" db:"kind"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// Scopes that can be granted to API keys.
+const (
+	ScopeLabTestsRead       = "lab_tests:read"
+	ScopeLabTestsWrite      = "lab_tests:write"
+	ScopePrescriptionsRead  = "prescriptions:read"
+	ScopePrescriptionsWrite = "prescriptions:write"
+	ScopeClaimsRead         = "claims:read"
+	ScopeClaimsWrite        = "claims:write"
+	ScopeAPIKeysManage      = "api_keys:manage"
+)
+
+// APIKeyScopes lists every scope an API key can hold.
+var APIKeyScopes = []string{
+	ScopeLabTestsRead,
+	ScopeLabTestsWrite,
+	ScopePrescriptionsRead,
+	ScopePrescriptionsWrite,
+	ScopeClaimsRead,
+	ScopeClaimsWrite,
+	ScopeAPIKeysManage,
+}
+
+// APIKey is a credential for a partner organisation's systems. Only the
+// key's prefix, used to look it up, and a SHA-256 hash of the whole key are
+// stored.
+type APIKey struct {
+	ID             int64      `json:"id" db:"id"`
+	OrganisationID int64      `json:"organisation_id" db:"organisation_id"`
+	Name           string     `json:"name" db:"name"`
+	Prefix         string     `json:"prefix" db:"prefix"`
+	KeyHash        []byte     `json:"-" db:"key_hash"`
+	Scopes         []string   `json:"scopes" db:"scopes"`
+	CreatedBy      *int64     `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt     *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+// Valid reports whether the key has neither been revoked nor expired.
+func (k *APIKey) Valid() bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || time.Now().Before(*k.ExpiresAt))
+}
+
+// HasScope reports whether the key grants scope.
+func (k *APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+// OrganisationMember links a staff user to their organisation. Members
+// hold the role matching the organisation's kind; admins may also invite
+// and remove staff and manage the organisation's API keys.
+type OrganisationMember struct {
+	OrganisationID int64     `json:"organisation_id" db:"organisation_id"`
+	UserID         int64     `json:"user_id" db:"user_id"`
+	FirstName      string    `json:"first_name" db:"first_name"`
+	LastName       string    `json:"last_name" db:"last_name"`
+	Email          Email     `json:"email" db:"email"`
+	IsAdmin        bool      `json:"is_admin" db:"is_admin"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
+
+// OrganisationInvitation is an emailed invitation to join an organisation
+// as staff. Only a SHA-256 hash of the invitation token is stored.
+type OrganisationInvitation struct {
+	ID             int64      `json:"id" db:"id"`
+	OrganisationID int64      `json:"organisation_id" db:"organisation_id"`
+	Email          Email      `json:"email" db:"email"`
+	IsAdmin        bool       `json:"is_admin" db:"is_admin"`
+	TokenHash      []byte     `json:"-" db:"token_hash"`
+	InvitedBy      *int64     `json:"invited_by,omitempty" db:"invited_by"`
+	ExpiresAt      time.Time  `json:"expires_at" db:"expires_at"`
+	AcceptedAt     *time.Time `json:"accepted_at,omitempty" db:"accepted_at"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// PhoneOTP is a one-time sign-in code sent by SMS. Only a SHA-256 hash of
+// the code is stored. UserID is nil when the code was requested for a
+// number with no account; such codes are kept so send limits apply the
+// same way to every number, but they can never be redeemed.
+type PhoneOTP struct {
+	ID        int64      `json:"id" db:"id"`
+	Phone     string     `json:"phone" db:"phone"`
+	UserID    *int64     `json:"user_id,omitempty" db:"user_id"`
+	CodeHash  []byte     `json:"-" db:"code_hash"`
+	Attempts  int        `json:"attempts" db:"attempts"`
+	IPAddress string     `json:"ip_address" db:"ip_address"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty" db:"used_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
+
+// PhoneChange is a pending change of a user's phone number. It takes effect
+// once the code texted to the new number is entered. Only a SHA-256 hash of
+// the code is stored.
+type PhoneChange struct {
+	ID        int64      `json:"id" db:"id"`
+	UserID    int64      `json:"user_id" db:"user_id"`
+	NewPhone  string     `json:"new_phone" db:"new_phone"`
+	CodeHash  []byte     `json:"-" db:"code_hash"`
+	Attempts  int        `json:"attempts" db:"attempts"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty" db:"used_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Names of the permissions seeded by the permissions migration.
+const (
+	PermissionManageRoles = "roles:manage"
+	PermissionManageUsers = "users:manage"
+
+	PermissionManageOrganisations = "organisations:manage"
+	PermissionReviewDoctors       = "doctors:review"
+)
+
+// Permission is a named right that can be granted to roles.
+type Permission struct {
+	ID          int64     `json:"id" db:"id"`
+	Name        string    `json:"name" db:"name"`
+	Description string    `json:"description" db:"description"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Session is a signed-in device. It corresponds to one refresh token family
+// and lasts from sign-in until logout, revocation or refresh token expiry.
+type Session struct {
+	ID         string     `json:"id" db:"id"`
+	UserID     int64      `json:"-" db:"user_id"`
+	UserAgent  string     `json:"user_agent" db:"user_agent"`
+	IPAddress  string     `json:"ip_address" db:"ip_address"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at" db:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+
+	// Current is set when listing sessions to mark the caller's own one.
+	Current bool `json:"current" db:"-"`
+}
@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// RefreshToken is the server-side record of an issued refresh token. Only a
+// SHA-256 hash of the token's ID (jti) is stored, never the token itself.
+//
+// Every token belongs to a family that starts at login; each rotation adds a
+// new token to the same family and marks the previous one as rotated.
+type RefreshToken struct {
+	ID        int64      `json:"id" db:"id"`
+	UserID    int64      `json:"user_id" db:"user_id"`
+	FamilyID  string     `json:"family_id" db:"family_id"`
+	TokenHash []byte     `json:"-" db:"token_hash"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty" db:"rotated_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+// Valid reports whether the token has neither been revoked nor expired.
+func (t *RefreshToken) Valid() bool {
+	return t.RevokedAt == nil && time.Now().Before(t.ExpiresAt)
+}
+
+// Purposes of single-use user tokens.
+const (
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposeMagicLink         = "magic_link"
+	TokenPurposeMFAChallenge      = "mfa_challenge"
+)
+
+// UserToken is a single-use, expiring token sent to a user out of band, for
+// example in a password reset email. Only a SHA-256 hash of the token is
+// stored.
+type UserToken struct {
+	ID        int64      `json:"id" db:"id"`
+	UserID    int64      `json:"user_id" db:"user_id"`
+	Purpose   string     `json:"purpose" db:"purpose"`
+	TokenHash []byte     `json:"-" db:"token_hash"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty" db:"used_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
+
+// EmailChange is a pending change of a user's email address. It takes
+// effect once the link sent to the new address is followed. Only a
+// SHA-256 hash of the link's token is stored.
+type EmailChange struct {
+	ID        int64      `json:"id" db:"id"`
+	UserID    int64      `json:"user_id" db:"user_id"`
+	NewEmail  Email      `json:"new_email" db:"new_email"`
+	TokenHash []byte     `json:"-" db:"token_hash"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty" db:"used_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
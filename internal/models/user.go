@@ -21,14 +21,25 @@ import (
 	"fmt"
 	"time"
 
-	"golang.org/x/crypto/bcrypt"
+	"github.com/golangnigeria/liveright_backend/internal/password"
+)
+
+// Names of the roles seeded by the roles migration.
+const (
+	RolePatient   = "patient"
+	RoleDoctor    = "doctor"
+	RoleLab       = "lab"
+	RolePharmacy  = "pharmacy"
+	RoleInsurance = "insurance"
+	RoleAdmin     = "admin"
 )
 
 // Role represents a user role (e.g., admin, doctor, patient)
 type Role struct {
-	ID        int64     `json:"id" db:"id"`
-	Name      string    `json:"name" db:"name"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	ID          int64     `json:"id" db:"id"`
+	Name        string    `json:"name" db:"name"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	Permissions []string  `json:"permissions,omitempty" db:"-"`
 }
 
 // Email is a case-insensitive email type backed by PostgreSQL CITEXT.
@@ -64,11 +75,25 @@ type User struct {
 	RoleID       Role      `json:"role_id" db:"role_id"`
 	Phone        *string   `json:"phone,omitempty" db:"phone"` // nullable
 	Active       bool      `json:"active" db:"active"`
+
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty" db:"email_verified_at"` // nullable
+	PhoneVerifiedAt *time.Time `json:"phone_verified_at,omitempty" db:"phone_verified_at"` // nullable
+}
+
+// EmailVerified reports whether the user has confirmed their email address.
+func (u *User) EmailVerified() bool {
+	return u.EmailVerifiedAt != nil
 }
 
-// HashPassword sets PasswordHash using bcrypt
-func (u *User) HashPassword(plain string) error {
-	hashed, err := bcrypt.GenerateFromPassword([]byte(plain), bcrypt.DefaultCost)
+// PhoneVerified reports whether the user has confirmed their phone number
+// with a texted code. Only confirmed numbers can be used to sign in.
+func (u *User) PhoneVerified() bool {
+	return u.PhoneVerifiedAt != nil
+}
+
+// HashPassword sets PasswordHash to a hash of plain made with params.
+func (u *User) HashPassword(plain string, params password.Params) error {
+	hashed, err := params.Hash(plain)
 	if err != nil {
 		return err
 	}
@@ -76,14 +101,10 @@ func (u *User) HashPassword(plain string) error {
 	return nil
 }
 
-// PasswordMatches compares password with hash
-func (u *User) PasswordMatches(plainText string) (bool, error) {
-	err := bcrypt.CompareHashAndPassword(u.PasswordHash, []byte(plainText))
-	if err != nil {
-		if err == bcrypt.ErrMismatchedHashAndPassword {
-			return false, nil
-		}
-		return false, err
-	}
-	return true, nil
+// PasswordMatches compares password with hash. needsRehash is true when the
+// password matched but the stored hash was made with an algorithm or
+// parameters other than params, in which case the caller should hash the
+// password again and store the result.
+func (u *User) PasswordMatches(plainText string, params password.Params) (match bool, needsRehash bool, err error) {
+	return params.Verify(u.PasswordHash, plainText)
 }
@@ -0,0 +1,172 @@
+package password
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Algorithm names a password hashing algorithm.
+type Algorithm string
+
+const (
+	Bcrypt   Algorithm = "bcrypt"
+	Argon2id Algorithm = "argon2id"
+)
+
+// Params configures how new password hashes are produced. Stored hashes
+// record the algorithm and parameters they were made with, in the usual
+// modular crypt format ($2a$... for bcrypt, $argon2id$v=19$... for
+// argon2id), so they can still be verified after Params change.
+type Params struct {
+	Algorithm Algorithm
+
+	BcryptCost int
+
+	// Argon2Memory is in KiB.
+	Argon2Memory      uint32
+	Argon2Iterations  uint32
+	Argon2Parallelism uint8
+	Argon2SaltLength  uint32
+	Argon2KeyLength   uint32
+}
+
+// DefaultParams follow the OWASP recommendation for argon2id.
+var DefaultParams = Params{
+	Algorithm:         Argon2id,
+	BcryptCost:        bcrypt.DefaultCost,
+	Argon2Memory:      19 * 1024,
+	Argon2Iterations:  2,
+	Argon2Parallelism: 1,
+	Argon2SaltLength:  16,
+	Argon2KeyLength:   32,
+}
+
+// Validate checks that p can be used to hash passwords.
+func (p Params) Validate() error {
+	switch p.Algorithm {
+	case Bcrypt:
+		if p.BcryptCost < bcrypt.MinCost || p.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case Argon2id:
+		if p.Argon2Memory == 0 || p.Argon2Iterations == 0 || p.Argon2Parallelism == 0 ||
+			p.Argon2SaltLength == 0 || p.Argon2KeyLength == 0 {
+			return errors.New("argon2id parameters must all be positive")
+		}
+	default:
+		return fmt.Errorf("unknown password hashing algorithm %q", p.Algorithm)
+	}
+
+	return nil
+}
+
+// Hash hashes plain with p.
+func (p Params) Hash(plain string) ([]byte, error) {
+	if p.Algorithm == Bcrypt {
+		return bcrypt.GenerateFromPassword([]byte(plain), p.BcryptCost)
+	}
+
+	salt := make([]byte, p.Argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	key := argon2.IDKey([]byte(plain), salt, p.Argon2Iterations, p.Argon2Memory, p.Argon2Parallelism, p.Argon2KeyLength)
+
+	encoded := fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Argon2Memory, p.Argon2Iterations, p.Argon2Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+
+	return []byte(encoded), nil
+}
+
+// Verify reports whether plain matches hash, and whether hash was made with
+// an algorithm or parameters other than p and should be replaced by a fresh
+// Hash of plain.
+func (p Params) Verify(hash []byte, plain string) (match bool, needsRehash bool, err error) {
+	if bytes.HasPrefix(hash, []byte("$argon2id$")) {
+		stored, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false, false, err
+		}
+
+		candidate := argon2.IDKey([]byte(plain), salt, stored.Argon2Iterations, stored.Argon2Memory, stored.Argon2Parallelism, uint32(len(key)))
+		if subtle.ConstantTimeCompare(candidate, key) != 1 {
+			return false, false, nil
+		}
+
+		outdated := p.Algorithm != Argon2id ||
+			stored.Argon2Memory != p.Argon2Memory ||
+			stored.Argon2Iterations != p.Argon2Iterations ||
+			stored.Argon2Parallelism != p.Argon2Parallelism ||
+			uint32(len(salt)) != p.Argon2SaltLength ||
+			uint32(len(key)) != p.Argon2KeyLength
+
+		return true, outdated, nil
+	}
+
+	err = bcrypt.CompareHashAndPassword(hash, []byte(plain))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, false, nil
+		}
+		return false, false, err
+	}
+
+	cost, err := bcrypt.Cost(hash)
+	if err != nil {
+		return false, false, err
+	}
+
+	return true, p.Algorithm != Bcrypt || cost != p.BcryptCost, nil
+}
+
+// decodeArgon2id parses $argon2id$v=19$m=...,t=...,p=...$salt$key.
+func decodeArgon2id(hash []byte) (Params, []byte, []byte, error) {
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 {
+		return Params{}, nil, nil, errors.New("malformed argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return Params{}, nil, nil, errors.New("malformed argon2id hash")
+	}
+	if version != argon2.Version {
+		return Params{}, nil, nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+
+	p := Params{Algorithm: Argon2id}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Argon2Memory, &p.Argon2Iterations, &p.Argon2Parallelism); err != nil {
+		return Params{}, nil, nil, errors.New("malformed argon2id hash")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Params{}, nil, nil, errors.New("malformed argon2id hash")
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return Params{}, nil, nil, errors.New("malformed argon2id hash")
+	}
+
+	// an empty key would match every password, and zero costs make
+	// argon2.IDKey panic
+	if len(salt) == 0 || len(key) == 0 ||
+		p.Argon2Memory < 1 || p.Argon2Iterations < 1 || p.Argon2Parallelism < 1 {
+		return Params{}, nil, nil, errors.New("malformed argon2id hash")
+	}
+
+	return p, salt, key, nil
+}
@@ -0,0 +1,146 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testParams keep hashing cheap; the values are still valid.
+var testParams = Params{
+	Algorithm:         Argon2id,
+	BcryptCost:        bcrypt.MinCost,
+	Argon2Memory:      64,
+	Argon2Iterations:  1,
+	Argon2Parallelism: 1,
+	Argon2SaltLength:  16,
+	Argon2KeyLength:   32,
+}
+
+// with returns testParams changed by edit.
+func with(edit func(p *Params)) Params {
+	p := testParams
+	edit(&p)
+	return p
+}
+
+func TestParamsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  Params
+		wantErr bool
+	}{
+		{"defaults", DefaultParams, false},
+		{"argon2id", testParams, false},
+		{"bcrypt", with(func(p *Params) { p.Algorithm = Bcrypt }), false},
+		{"bcrypt cost too low", with(func(p *Params) { p.Algorithm = Bcrypt; p.BcryptCost = bcrypt.MinCost - 1 }), true},
+		{"bcrypt cost too high", with(func(p *Params) { p.Algorithm = Bcrypt; p.BcryptCost = bcrypt.MaxCost + 1 }), true},
+		{"argon2id without memory", with(func(p *Params) { p.Argon2Memory = 0 }), true},
+		{"unknown algorithm", with(func(p *Params) { p.Algorithm = "md5" }), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.params.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHashVerifyRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		params Params
+		prefix string
+	}{
+		{"argon2id", testParams, "$argon2id$v=19$m=64,t=1,p=1$"},
+		{"bcrypt", with(func(p *Params) { p.Algorithm = Bcrypt }), "$2a$04$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := tt.params.Hash("correct-Horse7")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(string(hash), tt.prefix) {
+				t.Errorf("hash %q does not start with %q", hash, tt.prefix)
+			}
+
+			match, needsRehash, err := tt.params.Verify(hash, "correct-Horse7")
+			if err != nil || !match || needsRehash {
+				t.Errorf("Verify(right password) = %v, %v, %v; want true, false, nil", match, needsRehash, err)
+			}
+
+			match, _, err = tt.params.Verify(hash, "wrong-Horse7")
+			if err != nil || match {
+				t.Errorf("Verify(wrong password) = %v, %v; want false, nil", match, err)
+			}
+		})
+	}
+}
+
+func TestVerifyNeedsRehash(t *testing.T) {
+	bcryptParams := with(func(p *Params) { p.Algorithm = Bcrypt })
+
+	tests := []struct {
+		name     string
+		hashedAs Params
+		current  Params
+		want     bool
+	}{
+		{"same argon2id parameters", testParams, testParams, false},
+		{"argon2id memory raised", testParams, with(func(p *Params) { p.Argon2Memory = 128 }), true},
+		{"argon2id iterations raised", testParams, with(func(p *Params) { p.Argon2Iterations = 2 }), true},
+		{"argon2id key length changed", testParams, with(func(p *Params) { p.Argon2KeyLength = 64 }), true},
+		{"legacy bcrypt", bcryptParams, testParams, true},
+		{"bcrypt cost raised", bcryptParams, with(func(p *Params) { p.Algorithm = Bcrypt; p.BcryptCost = bcrypt.MinCost + 1 }), true},
+		{"same bcrypt cost", bcryptParams, bcryptParams, false},
+		{"argon2id after switching to bcrypt", testParams, bcryptParams, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := tt.hashedAs.Hash("correct-Horse7")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			match, needsRehash, err := tt.current.Verify(hash, "correct-Horse7")
+			if err != nil || !match {
+				t.Fatalf("Verify() = %v, %v; want a match", match, err)
+			}
+			if needsRehash != tt.want {
+				t.Errorf("needsRehash = %v, want %v", needsRehash, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyMalformedHash(t *testing.T) {
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{"truncated argon2id", "$argon2id$v=19$m=64,t=1,p=1$c2FsdA"},
+		{"unsupported argon2 version", "$argon2id$v=16$m=64,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5"},
+		{"bad argon2id parameters", "$argon2id$v=19$m=x,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5"},
+		{"empty key", "$argon2id$v=19$m=64,t=1,p=1$c2FsdA$"},
+		{"empty salt", "$argon2id$v=19$m=64,t=1,p=1$$a2V5"},
+		{"no memory", "$argon2id$v=19$m=0,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5"},
+		{"no iterations", "$argon2id$v=19$m=64,t=0,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5"},
+		{"no parallelism", "$argon2id$v=19$m=64,t=1,p=0$c2FsdHNhbHRzYWx0c2FsdA$a2V5"},
+		{"not a hash", "plaintext"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, _, err := testParams.Verify([]byte(tt.hash), "correct-Horse7")
+			if err == nil || match {
+				t.Errorf("Verify() = %v, %v; want an error", match, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+// Package password holds the rules that user passwords must satisfy and
+// the algorithms used to hash them.
+package password
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Policy describes what makes a password acceptable.
+type Policy struct {
+	// MinLength is the minimum number of characters.
+	MinLength int
+
+	// MaxBytes is the maximum encoded length. bcrypt silently ignores
+	// everything past 72 bytes, so longer passwords are refused rather than
+	// truncated.
+	MaxBytes int
+
+	// MinCharacterClasses is how many of upper case, lower case, digits and
+	// symbols must appear.
+	MinCharacterClasses int
+
+	// Breached, when set, rejects passwords known from public breaches.
+	Breached *BreachedList
+}
+
+// Violation is one rule a password failed.
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PolicyError lists every rule a password failed.
+type PolicyError struct {
+	Violations []Violation
+}
+
+func (e *PolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// minPersonalLength is the shortest name or email part that is checked for
+// inside passwords; anything shorter matches too much by accident.
+const minPersonalLength = 3
+
+// Validate checks plain against the policy. personal holds the user's email
+// address and names, none of which may appear in the password. It returns
+// a *PolicyError listing every failed rule, or nil.
+func (p Policy) Validate(plain string, personal ...string) error {
+	var violations []Violation
+
+	if utf8.RuneCountInString(plain) < p.MinLength {
+		violations = append(violations, Violation{
+			Rule:    "min_length",
+			Message: "password must be at least " + strconv.Itoa(p.MinLength) + " characters long",
+		})
+	}
+
+	if p.MaxBytes > 0 && len(plain) > p.MaxBytes {
+		violations = append(violations, Violation{
+			Rule:    "max_bytes",
+			Message: "password must be at most " + strconv.Itoa(p.MaxBytes) + " bytes long",
+		})
+	}
+
+	if characterClasses(plain) < p.MinCharacterClasses {
+		violations = append(violations, Violation{
+			Rule:    "character_classes",
+			Message: "password must mix at least " + strconv.Itoa(p.MinCharacterClasses) + " of upper case letters, lower case letters, digits and symbols",
+		})
+	}
+
+	if containsPersonalInfo(plain, personal) {
+		violations = append(violations, Violation{
+			Rule:    "personal_info",
+			Message: "password must not contain your name or email address",
+		})
+	}
+
+	if p.Breached != nil && p.Breached.Contains(plain) {
+		violations = append(violations, Violation{
+			Rule:    "breached",
+			Message: "password appears in a list of breached passwords, please choose another",
+		})
+	}
+
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+
+	return nil
+}
+
+func characterClasses(plain string) int {
+	var upper, lower, digit, symbol bool
+
+	for _, r := range plain {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	count := 0
+	for _, present := range []bool{upper, lower, digit, symbol} {
+		if present {
+			count++
+		}
+	}
+	return count
+}
+
+func containsPersonalInfo(plain string, personal []string) bool {
+	lowered := strings.ToLower(plain)
+
+	var parts []string
+	for _, value := range personal {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if local, _, ok := strings.Cut(value, "@"); ok {
+			parts = append(parts, local)
+			continue
+		}
+		parts = append(parts, strings.Fields(value)...)
+	}
+
+	for _, part := range parts {
+		if utf8.RuneCountInString(part) >= minPersonalLength && strings.Contains(lowered, part) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// BreachedList is a set of passwords known from public breaches. Only
+// SHA-1 hashes are held, so a large list costs 20 bytes per entry.
+type BreachedList struct {
+	hashes map[[sha1.Size]byte]struct{}
+}
+
+// LoadBreachedList reads a gzip compressed file holding one entry per line.
+// Lines starting with # are comments. An entry is either a plain password,
+// matched case-insensitively, or the upper case hex SHA-1 of a password
+// optionally followed by :count, as in the Pwned Passwords downloads, so a
+// real breach corpus can be used without storing it in the clear.
+func LoadBreachedList(path string) (*BreachedList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	list := &BreachedList{hashes: make(map[[sha1.Size]byte]struct{})}
+
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if hash, ok := parseSHA1Line(line); ok {
+			list.hashes[hash] = struct{}{}
+			continue
+		}
+
+		list.hashes[sha1.Sum([]byte(strings.ToLower(line)))] = struct{}{}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// parseSHA1Line reads a Pwned Passwords line: 40 upper case hex digits,
+// optionally followed by :count.
+func parseSHA1Line(line string) ([sha1.Size]byte, bool) {
+	var hash [sha1.Size]byte
+
+	digest, _, _ := strings.Cut(line, ":")
+	if len(digest) != hex.EncodedLen(sha1.Size) || strings.ToUpper(digest) != digest {
+		return hash, false
+	}
+
+	if _, err := hex.Decode(hash[:], []byte(digest)); err != nil {
+		return hash, false
+	}
+
+	return hash, true
+}
+
+// Len returns the number of entries in the list.
+func (l *BreachedList) Len() int {
+	return len(l.hashes)
+}
+
+// Contains reports whether plain is in the list, either exactly or, for
+// plain entries, ignoring case.
+func (l *BreachedList) Contains(plain string) bool {
+	if _, found := l.hashes[sha1.Sum([]byte(plain))]; found {
+		return true
+	}
+	_, found := l.hashes[sha1.Sum([]byte(strings.ToLower(plain)))]
+	return found
+}
@@ -0,0 +1,132 @@
+package password
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeBreachedList writes lines to a gzip compressed file in a temporary
+// directory and returns its path.
+func writeBreachedList(t *testing.T, lines ...string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "breached.txt.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	for _, line := range lines {
+		if _, err := gz.Write([]byte(line + "\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestPolicyValidate(t *testing.T) {
+	breached, err := LoadBreachedList(writeBreachedList(t, "# comment", "Password123!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := Policy{
+		MinLength:           10,
+		MaxBytes:            72,
+		MinCharacterClasses: 2,
+		Breached:            breached,
+	}
+
+	personal := []string{"ada.obi@example.com", "Ada", "Obi"}
+
+	tests := []struct {
+		name     string
+		password string
+		want     []string
+	}{
+		{"acceptable", "correct-Horse7", nil},
+		{"too short", "Sh0rt!", []string{"min_length"}},
+		{"too long", "A1" + strings.Repeat("a", 71), []string{"max_bytes"}},
+		{"one character class", "lowercaseonly", []string{"character_classes"}},
+		{"contains name", "Obinna-Runs-9", []string{"personal_info"}},
+		{"contains email local part", "x-ada.obi@home-1", []string{"personal_info"}},
+		{"breached ignoring case", "PASSWORD123!", []string{"breached"}},
+		{"several rules", "ada", []string{"min_length", "character_classes", "personal_info"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Validate(tt.password, personal...)
+
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+
+			perr, ok := err.(*PolicyError)
+			if !ok {
+				t.Fatalf("Validate() = %v, want *PolicyError", err)
+			}
+
+			var rules []string
+			for _, v := range perr.Violations {
+				rules = append(rules, v.Rule)
+			}
+			if !slices.Equal(rules, tt.want) {
+				t.Errorf("violations = %v, want %v", rules, tt.want)
+			}
+		})
+	}
+}
+
+func TestBreachedListFormats(t *testing.T) {
+	list, err := LoadBreachedList(writeBreachedList(t,
+		"# plain entries match ignoring case",
+		"Sunshine2024",
+		"",
+		// SHA-1 of "P@ssw0rd" in the Pwned Passwords format
+		"21BD12DC183F740EE76F27B78EB39C8AD972A757:52579",
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if list.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", list.Len())
+	}
+
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{"sunshine2024", true},
+		{"SUNSHINE2024", true},
+		{"P@ssw0rd", true},
+		{"p@ssw0rd", false},
+		{"not-in-the-list", false},
+	}
+
+	for _, tt := range tests {
+		if got := list.Contains(tt.password); got != tt.want {
+			t.Errorf("Contains(%q) = %v, want %v", tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestLoadBreachedListMissingFile(t *testing.T) {
+	if _, err := LoadBreachedList(filepath.Join(t.TempDir(), "missing.txt.gz")); err == nil {
+		t.Error("LoadBreachedList() succeeded for a missing file")
+	}
+}
@@ -0,0 +1,64 @@
+// Package phone normalises phone numbers so the same number is always
+// stored and looked up in one form, E.164 (for example +2348031234567).
+package phone
+
+import (
+	"errors"
+	"strings"
+)
+
+// CountryCode is the calling code assumed for numbers written in national
+// form.
+const CountryCode = "234"
+
+// ErrInvalid is returned for input that is not a usable phone number.
+var ErrInvalid = errors.New("invalid phone number")
+
+// Normalize converts a phone number to E.164. Spaces, dashes, dots and
+// brackets are ignored. Nigerian numbers may be given in national form
+// (08031234567), without the trunk prefix (8031234567) or with the country
+// code (2348031234567, +2348031234567); other countries need a leading +.
+func Normalize(number string) (string, error) {
+	var b strings.Builder
+	for i, r := range strings.TrimSpace(number) {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '+' && i == 0:
+			b.WriteRune(r)
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return "", ErrInvalid
+		}
+	}
+	digits := b.String()
+
+	switch {
+	case strings.HasPrefix(digits, "+"):
+		digits = digits[1:]
+	case strings.HasPrefix(digits, "00"):
+		digits = digits[2:]
+	case strings.HasPrefix(digits, CountryCode) && len(digits) == len(CountryCode)+10:
+	case strings.HasPrefix(digits, "0") && len(digits) == 11:
+		digits = CountryCode + digits[1:]
+	case len(digits) == 10:
+		digits = CountryCode + digits
+	default:
+		return "", ErrInvalid
+	}
+
+	// Nigerian subscriber numbers are ten digits and never start with 0
+	if strings.HasPrefix(digits, CountryCode) {
+		national := digits[len(CountryCode):]
+		if len(national) != 10 || national[0] == '0' {
+			return "", ErrInvalid
+		}
+	}
+
+	// E.164 allows at most 15 digits; anything under 8 is not a real number
+	if len(digits) < 8 || len(digits) > 15 || digits[0] == '0' {
+		return "", ErrInvalid
+	}
+
+	return "+" + digits, nil
+}
@@ -0,0 +1,65 @@
+package phone
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"national", "08031234567", "+2348031234567"},
+		{"national with spaces", " 0803 123 4567 ", "+2348031234567"},
+		{"national with punctuation", "(0803) 123-45.67", "+2348031234567"},
+		{"without trunk prefix", "8031234567", "+2348031234567"},
+		{"country code without plus", "2348031234567", "+2348031234567"},
+		{"plus country code", "+2348031234567", "+2348031234567"},
+		{"plus country code with spaces", "+234 803 123 4567", "+2348031234567"},
+		{"international prefix", "002348031234567", "+2348031234567"},
+		{"other country with plus", "+447911123456", "+447911123456"},
+		{"other country with 00", "00447911123456", "+447911123456"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Normalize(tt.input)
+			if err != nil {
+				t.Fatalf("Normalize(%q) error = %v", tt.input, err)
+			}
+			if got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"empty", ""},
+		{"letters", "0803ABC4567"},
+		{"plus not first", "234+8031234567"},
+		{"national too short", "0803123456"},
+		{"national too long", "080312345678"},
+		{"nigerian subscriber starting with 0", "+2340031234567"},
+		{"nigerian number too short", "+234803123456"},
+		{"too short", "+1234567"},
+		{"too long", "+1234567890123456"},
+		{"country code starting with 0", "+0123456789"},
+		{"no country code", "12345"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Normalize(tt.input)
+			if !errors.Is(err, ErrInvalid) {
+				t.Errorf("Normalize(%q) = %q, %v; want ErrInvalid", tt.input, got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/golangnigeria/liveright_backend/internal/models"
+)
+
+// insertAuditEntry appends entry to the audit log using q, which may be the
+// pool or a transaction.
+func insertAuditEntry(ctx context.Context, q interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}, entry *models.AuditEntry) error {
+	metadata := entry.Metadata
+	if metadata == nil {
+		metadata = map[string]any{}
+	}
+
+	rawMetadata, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+
+	var userID sql.NullInt64
+	if entry.UserID != nil {
+		userID = sql.NullInt64{Int64: *entry.UserID, Valid: true}
+	}
+
+	query := `
+		INSERT INTO audit_log (user_id, action, ip_address, user_agent, metadata)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+
+	return q.QueryRowContext(ctx, query,
+		userID,
+		entry.Action,
+		entry.IPAddress,
+		entry.UserAgent,
+		rawMetadata,
+	).Scan(&entry.ID, &entry.CreatedAt)
+}
+
+// InsertAuditEntry appends an entry to the audit log.
+func (m *PostgresDBRepo) InsertAuditEntry(entry *models.AuditEntry) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return insertAuditEntry(ctx, m.DB, entry)
+}
+
+// GetAuditEntriesForUser returns every audit log entry recorded against
+// the user, oldest first.
+func (m *PostgresDBRepo) GetAuditEntriesForUser(userID int64) ([]*models.AuditEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT id, user_id, action, ip_address, user_agent, metadata, created_at
+		FROM audit_log
+		WHERE user_id = $1
+		ORDER BY created_at, id
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*models.AuditEntry
+	for rows.Next() {
+		var entry models.AuditEntry
+		var entryUserID sql.NullInt64
+		var ip, userAgent sql.NullString
+		var rawMetadata []byte
+
+		err := rows.Scan(
+			&entry.ID,
+			&entryUserID,
+			&entry.Action,
+			&ip,
+			&userAgent,
+			&rawMetadata,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if entryUserID.Valid {
+			entry.UserID = &entryUserID.Int64
+		}
+		entry.IPAddress = ip.String
+		entry.UserAgent = userAgent.String
+
+		if err := json.Unmarshal(rawMetadata, &entry.Metadata); err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, &entry)
+	}
+
+	return entries, rows.Err()
+}
@@ -0,0 +1,269 @@
+package dbrepo
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+
+	"github.com/golangnigeria/liveright_backend/internal/models"
+	"github.com/golangnigeria/liveright_backend/internal/repository"
+)
+
+// accountDeletionColumns lists the account_deletions columns read by
+// scanAccountDeletion, in order.
+const accountDeletionColumns = `
+	id, user_id, requested_at, scheduled_for, cancelled_at, completed_at,
+	certificate_id
+`
+
+// scanAccountDeletion reads a row selected with accountDeletionColumns.
+func scanAccountDeletion(row interface{ Scan(dest ...any) error }) (*models.AccountDeletion, error) {
+	var deletion models.AccountDeletion
+	var cancelledAt, completedAt sql.NullTime
+	var certificateID sql.NullString
+
+	err := row.Scan(
+		&deletion.ID,
+		&deletion.UserID,
+		&deletion.RequestedAt,
+		&deletion.ScheduledFor,
+		&cancelledAt,
+		&completedAt,
+		&certificateID,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, err
+	}
+
+	if cancelledAt.Valid {
+		deletion.CancelledAt = &cancelledAt.Time
+	}
+	if completedAt.Valid {
+		deletion.CompletedAt = &completedAt.Time
+	}
+	if certificateID.Valid {
+		deletion.CertificateID = &certificateID.String
+	}
+
+	return &deletion, nil
+}
+
+// InsertAccountDeletion records a deletion request. It returns
+// repository.ErrDuplicate when the user already has one pending.
+func (m *PostgresDBRepo) InsertAccountDeletion(deletion *models.AccountDeletion) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO account_deletions (user_id, scheduled_for)
+		VALUES ($1, $2)
+		RETURNING id, requested_at
+	`
+
+	err := m.DB.QueryRowContext(ctx, query, deletion.UserID, deletion.ScheduledFor).
+		Scan(&deletion.ID, &deletion.RequestedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return repository.ErrDuplicate
+		}
+		return err
+	}
+
+	return nil
+}
+
+// GetPendingAccountDeletion returns the user's deletion request that has
+// been neither cancelled nor carried out, or sql.ErrNoRows.
+func (m *PostgresDBRepo) GetPendingAccountDeletion(userID int64) (*models.AccountDeletion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT ` + accountDeletionColumns + `
+		FROM account_deletions
+		WHERE user_id = $1 AND cancelled_at IS NULL AND completed_at IS NULL
+	`
+
+	return scanAccountDeletion(m.DB.QueryRowContext(ctx, query, userID))
+}
+
+// CancelAccountDeletion cancels the user's pending deletion request. It
+// returns sql.ErrNoRows when there is none.
+func (m *PostgresDBRepo) CancelAccountDeletion(userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE account_deletions SET cancelled_at = now()
+		WHERE user_id = $1 AND cancelled_at IS NULL AND completed_at IS NULL
+	`
+
+	result, err := m.DB.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	return expectOneRow(result)
+}
+
+// GetDueAccountDeletions returns up to limit pending deletion requests whose
+// grace period has ended, oldest first.
+func (m *PostgresDBRepo) GetDueAccountDeletions(limit int) ([]*models.AccountDeletion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT ` + accountDeletionColumns + `
+		FROM account_deletions
+		WHERE cancelled_at IS NULL AND completed_at IS NULL AND scheduled_for <= now()
+		ORDER BY scheduled_for
+		LIMIT $1
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deletions []*models.AccountDeletion
+	for rows.Next() {
+		deletion, err := scanAccountDeletion(rows)
+		if err != nil {
+			return nil, err
+		}
+		deletions = append(deletions, deletion)
+	}
+
+	return deletions, rows.Err()
+}
+
+// AnonymiseUser carries out a deletion request in one transaction. The
+// user row is kept so that records retained by law still refer to it, but
+// everything that identifies the person is overwritten or deleted, the
+// request is marked complete with deletion.CertificateID and certificate is
+// written to the audit log. A request cancelled in the meantime yields
+// sql.ErrNoRows.
+func (m *PostgresDBRepo) AnonymiseUser(deletion *models.AccountDeletion, certificate *models.AuditEntry) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE account_deletions SET completed_at = now(), certificate_id = $2
+		WHERE id = $1 AND cancelled_at IS NULL AND completed_at IS NULL
+		RETURNING completed_at
+	`
+
+	var completedAt sql.NullTime
+	err = tx.QueryRowContext(ctx, query, deletion.ID, deletion.CertificateID).Scan(&completedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return sql.ErrNoRows
+		}
+		return err
+	}
+	deletion.CompletedAt = &completedAt.Time
+
+	var email string
+	var phone sql.NullString
+	err = tx.QueryRowContext(ctx,
+		`SELECT email, phone FROM users WHERE id = $1 FOR UPDATE`,
+		deletion.UserID,
+	).Scan(&email, &phone)
+	if err != nil {
+		return err
+	}
+
+	// A random value that is not a hash in any known format, so no
+	// password can ever match it
+	unusable := make([]byte, 32)
+	if _, err := rand.Read(unusable); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE users SET
+			first_name = 'Deleted',
+			last_name = 'User',
+			email = 'deleted-' || id || '@deleted.invalid',
+			phone = NULL,
+			phone_verified_at = NULL,
+			password_hash = $2,
+			active = FALSE,
+			email_verified_at = NULL
+		WHERE id = $1`,
+		deletion.UserID, unusable,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE doctors SET
+			bio = '',
+			profile_image = '',
+			licence_number = 'deleted-' || user_id,
+			updated_at = now()
+		WHERE user_id = $1`,
+		deletion.UserID,
+	)
+	if err != nil {
+		return err
+	}
+
+	byUser := []string{
+		`DELETE FROM refresh_tokens WHERE user_id = $1`,
+		`DELETE FROM sessions WHERE user_id = $1`,
+		`DELETE FROM user_tokens WHERE user_id = $1`,
+		`DELETE FROM mfa_recovery_codes WHERE user_id = $1`,
+		`DELETE FROM user_totp WHERE user_id = $1`,
+		`DELETE FROM email_changes WHERE user_id = $1`,
+		`DELETE FROM phone_changes WHERE user_id = $1`,
+		`DELETE FROM phone_otps WHERE user_id = $1`,
+		`DELETE FROM organisation_members WHERE user_id = $1`,
+		`DELETE FROM data_exports WHERE user_id = $1`,
+		`UPDATE audit_log SET ip_address = NULL, user_agent = NULL, metadata = metadata - 'new_email' WHERE user_id = $1`,
+	}
+	for _, stmt := range byUser {
+		if _, err := tx.ExecContext(ctx, stmt, deletion.UserID); err != nil {
+			return err
+		}
+	}
+
+	byEmail := []string{
+		`DELETE FROM login_failures WHERE email = $1`,
+		`DELETE FROM account_lockouts WHERE email = $1`,
+		`DELETE FROM magic_link_requests WHERE email = lower($1)`,
+		`DELETE FROM organisation_invitations WHERE email = $1 AND accepted_at IS NULL`,
+		`UPDATE audit_log SET metadata = metadata - 'email' WHERE lower(metadata->>'email') = lower($1)`,
+	}
+	for _, stmt := range byEmail {
+		if _, err := tx.ExecContext(ctx, stmt, email); err != nil {
+			return err
+		}
+	}
+
+	// Codes sent to the number while it matched no account; codes for other
+	// users sharing the number are theirs to keep
+	if phone.Valid {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM phone_otps WHERE phone = $1 AND user_id IS NULL`, phone.String); err != nil {
+			return err
+		}
+	}
+
+	if err := insertAuditEntry(ctx, tx, certificate); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,204 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/golangnigeria/liveright_backend/internal/models"
+	"github.com/golangnigeria/liveright_backend/internal/repository"
+)
+
+// InsertDoctor creates a doctor's user account and their pending profile
+// in one transaction. It returns repository.ErrDuplicate when the email or
+// licence number is already registered.
+func (m *PostgresDBRepo) InsertDoctor(user *models.User, doctor *models.Doctor) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var phone sql.NullString
+	if user.Phone != nil {
+		phone = sql.NullString{String: *user.Phone, Valid: true}
+	}
+
+	query := `
+		INSERT INTO users (first_name, last_name, email, password_hash, role_id, phone, active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`
+
+	inserted := *user
+	err = tx.QueryRowContext(ctx, query,
+		user.FirstName,
+		user.LastName,
+		user.Email,
+		user.PasswordHash,
+		user.RoleID.ID,
+		phone,
+		user.Active,
+	).Scan(&inserted.ID, &inserted.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, repository.ErrDuplicate
+		}
+		return nil, err
+	}
+
+	query = `
+		INSERT INTO doctors (user_id, specialization, years_of_experience, bio, licence_number)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING status, created_at, updated_at
+	`
+
+	err = tx.QueryRowContext(ctx, query,
+		inserted.ID,
+		doctor.Specialization,
+		doctor.YearsOfExperience,
+		doctor.Bio,
+		doctor.LicenceNumber,
+	).Scan(&doctor.Status, &doctor.CreatedAt, &doctor.UpdatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, repository.ErrDuplicate
+		}
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	doctor.ID = inserted.ID
+	return &inserted, nil
+}
+
+// LicenceNumberRegistered reports whether a doctor has already applied with
+// licence.
+func (m *PostgresDBRepo) LicenceNumberRegistered(licence string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var exists bool
+	err := m.DB.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM doctors WHERE licence_number = $1)`, licence,
+	).Scan(&exists)
+	return exists, err
+}
+
+// doctorQuery selects a doctor's profile joined with their user account,
+// in the order read by scanDoctor.
+const doctorQuery = `
+	SELECT u.id, u.first_name, u.last_name, u.email, COALESCE(u.phone, ''),
+		d.specialization, d.years_of_experience, d.bio, d.profile_image,
+		d.licence_number, d.status, d.rejection_reason, d.reviewed_by,
+		d.reviewed_at, d.created_at, d.updated_at
+	FROM doctors d
+	JOIN users u ON u.id = d.user_id
+`
+
+// scanDoctor reads a row selected with doctorQuery.
+func scanDoctor(row interface{ Scan(dest ...any) error }) (*models.Doctor, error) {
+	var doctor models.Doctor
+	var rejectionReason sql.NullString
+	var reviewedBy sql.NullInt64
+	var reviewedAt sql.NullTime
+
+	err := row.Scan(
+		&doctor.ID,
+		&doctor.FirstName,
+		&doctor.LastName,
+		&doctor.Email,
+		&doctor.Phone,
+		&doctor.Specialization,
+		&doctor.YearsOfExperience,
+		&doctor.Bio,
+		&doctor.ProfileImage,
+		&doctor.LicenceNumber,
+		&doctor.Status,
+		&rejectionReason,
+		&reviewedBy,
+		&reviewedAt,
+		&doctor.CreatedAt,
+		&doctor.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, err
+	}
+
+	if rejectionReason.Valid {
+		doctor.RejectionReason = &rejectionReason.String
+	}
+	if reviewedBy.Valid {
+		doctor.ReviewedBy = &reviewedBy.Int64
+	}
+	if reviewedAt.Valid {
+		doctor.ReviewedAt = &reviewedAt.Time
+	}
+
+	return &doctor, nil
+}
+
+// GetDoctor returns the doctor profile of a user or sql.ErrNoRows.
+func (m *PostgresDBRepo) GetDoctor(userID int64) (*models.Doctor, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return scanDoctor(m.DB.QueryRowContext(ctx, doctorQuery+` WHERE d.user_id = $1`, userID))
+}
+
+// GetDoctorsByStatus lists doctors in the given review state, oldest
+// application first.
+func (m *PostgresDBRepo) GetDoctorsByStatus(status string) ([]*models.Doctor, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, doctorQuery+` WHERE d.status = $1 ORDER BY d.created_at`, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var doctors []*models.Doctor
+	for rows.Next() {
+		doctor, err := scanDoctor(rows)
+		if err != nil {
+			return nil, err
+		}
+		doctors = append(doctors, doctor)
+	}
+
+	return doctors, rows.Err()
+}
+
+// ReviewDoctor records an admin's decision on a pending application. It
+// returns sql.ErrNoRows when the user has no pending application.
+func (m *PostgresDBRepo) ReviewDoctor(userID int64, status string, reason *string, reviewerID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var rejectionReason sql.NullString
+	if reason != nil {
+		rejectionReason = sql.NullString{String: *reason, Valid: true}
+	}
+
+	query := `
+		UPDATE doctors
+		SET status = $2, rejection_reason = $3, reviewed_by = $4, reviewed_at = now(), updated_at = now()
+		WHERE user_id = $1 AND status = 'pending'
+	`
+
+	result, err := m.DB.ExecContext(ctx, query, userID, status, rejectionReason, reviewerID)
+	if err != nil {
+		return err
+	}
+	return expectOneRow(result)
+}
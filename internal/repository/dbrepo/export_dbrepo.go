@@ -0,0 +1,248 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/golangnigeria/liveright_backend/internal/models"
+	"github.com/golangnigeria/liveright_backend/internal/repository"
+)
+
+// dataExportColumns lists the data_exports columns read by scanDataExport,
+// in order. The archive itself is only read when it is downloaded.
+const dataExportColumns = `
+	id, user_id, status, download_token_hash, download_expires_at,
+	requested_at, completed_at, expires_at
+`
+
+// scanDataExport reads a row selected with dataExportColumns.
+func scanDataExport(row interface{ Scan(dest ...any) error }) (*models.DataExport, error) {
+	var export models.DataExport
+	var downloadExpiresAt, completedAt, expiresAt sql.NullTime
+
+	err := row.Scan(
+		&export.ID,
+		&export.UserID,
+		&export.Status,
+		&export.DownloadTokenHash,
+		&downloadExpiresAt,
+		&export.RequestedAt,
+		&completedAt,
+		&expiresAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, err
+	}
+
+	if downloadExpiresAt.Valid {
+		export.DownloadExpiresAt = &downloadExpiresAt.Time
+	}
+	if completedAt.Valid {
+		export.CompletedAt = &completedAt.Time
+	}
+	if expiresAt.Valid {
+		export.ExpiresAt = &expiresAt.Time
+	}
+
+	return &export, nil
+}
+
+// InsertDataExport queues a data export for the user. It returns
+// repository.ErrDuplicate when one is already being prepared.
+func (m *PostgresDBRepo) InsertDataExport(export *models.DataExport) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO data_exports (user_id)
+		VALUES ($1)
+		RETURNING id, status, requested_at
+	`
+
+	err := m.DB.QueryRowContext(ctx, query, export.UserID).
+		Scan(&export.ID, &export.Status, &export.RequestedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return repository.ErrDuplicate
+		}
+		return err
+	}
+
+	return nil
+}
+
+// GetDataExport returns one of the user's data exports, or sql.ErrNoRows.
+func (m *PostgresDBRepo) GetDataExport(userID, id int64) (*models.DataExport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `SELECT ` + dataExportColumns + ` FROM data_exports WHERE id = $1 AND user_id = $2`
+
+	return scanDataExport(m.DB.QueryRowContext(ctx, query, id, userID))
+}
+
+// GetPendingDataExports returns up to limit exports waiting to be prepared,
+// oldest first.
+func (m *PostgresDBRepo) GetPendingDataExports(limit int) ([]*models.DataExport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT ` + dataExportColumns + `
+		FROM data_exports
+		WHERE status = 'pending'
+		ORDER BY requested_at
+		LIMIT $1
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var exports []*models.DataExport
+	for rows.Next() {
+		export, err := scanDataExport(rows)
+		if err != nil {
+			return nil, err
+		}
+		exports = append(exports, export)
+	}
+
+	return exports, rows.Err()
+}
+
+// CompleteDataExport stores the prepared archive of a pending export and
+// keeps it until expiresAt. Any earlier archive of the user's is discarded,
+// so each user holds at most one.
+func (m *PostgresDBRepo) CompleteDataExport(id int64, archive []byte, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE data_exports SET status = 'ready', archive = $2, completed_at = now(), expires_at = $3
+		WHERE id = $1 AND status = 'pending'
+		RETURNING user_id
+	`
+
+	var userID int64
+	if err := tx.QueryRowContext(ctx, query, id, archive, expiresAt).Scan(&userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return sql.ErrNoRows
+		}
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE data_exports
+		SET status = 'expired', archive = NULL, download_token_hash = NULL, download_expires_at = NULL
+		WHERE user_id = $1 AND id <> $2 AND status = 'ready'`,
+		userID, id,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// FailDataExport marks a pending export as failed, letting the user ask
+// for a new one.
+func (m *PostgresDBRepo) FailDataExport(id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE data_exports SET status = 'failed', completed_at = now()
+		WHERE id = $1 AND status = 'pending'
+	`
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	return expectOneRow(result)
+}
+
+// SetDataExportDownloadToken replaces the download link of a ready export.
+// Earlier links stop working.
+func (m *PostgresDBRepo) SetDataExportDownloadToken(id int64, hash []byte, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE data_exports SET download_token_hash = $2, download_expires_at = $3
+		WHERE id = $1 AND status = 'ready' AND expires_at > now()
+	`
+
+	result, err := m.DB.ExecContext(ctx, query, id, hash, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	return expectOneRow(result)
+}
+
+// GetDataExportByDownloadToken returns the export, archive included, whose
+// download link has the token hash, provided neither the link nor the
+// export has expired. Otherwise it returns sql.ErrNoRows.
+func (m *PostgresDBRepo) GetDataExportByDownloadToken(hash []byte) (*models.DataExport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT ` + dataExportColumns + `
+		FROM data_exports
+		WHERE download_token_hash = $1
+			AND download_expires_at > now()
+			AND status = 'ready'
+			AND expires_at > now()
+	`
+
+	export, err := scanDataExport(m.DB.QueryRowContext(ctx, query, hash))
+	if err != nil {
+		return nil, err
+	}
+
+	// The archive may have been discarded in between
+	err = m.DB.QueryRowContext(ctx,
+		`SELECT archive FROM data_exports WHERE id = $1 AND archive IS NOT NULL`,
+		export.ID,
+	).Scan(&export.Archive)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, err
+	}
+
+	return export, nil
+}
+
+// ExpireDataExports discards the archives of exports past their expiry.
+func (m *PostgresDBRepo) ExpireDataExports() error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE data_exports
+		SET status = 'expired', archive = NULL, download_token_hash = NULL, download_expires_at = NULL
+		WHERE status = 'ready' AND expires_at <= now()
+	`
+
+	_, err := m.DB.ExecContext(ctx, query)
+	return err
+}
@@ -0,0 +1,158 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/golangnigeria/liveright_backend/internal/models"
+)
+
+// ReserveLoginAttempt stores a sign-in attempt for email from ip as a
+// failure before it is checked, and returns it with the failures recorded
+// since the given time. Attempts on the same email are serialised with an
+// advisory lock, so each sees every attempt made before it.
+func (m *PostgresDBRepo) ReserveLoginAttempt(email, ip string, since time.Time) (*models.LoginAttempt, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// email is CITEXT, so the lock key is case-insensitive too
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext(lower($1)))`, email); err != nil {
+		return nil, err
+	}
+
+	var attempt models.LoginAttempt
+	var last sql.NullTime
+
+	err = tx.QueryRowContext(ctx,
+		`SELECT count(*), max(created_at) FROM login_failures WHERE email = $1 AND created_at > $2`,
+		email, since,
+	).Scan(&attempt.Failures, &last)
+	if err != nil {
+		return nil, err
+	}
+	attempt.LastFailure = last.Time
+
+	err = tx.QueryRowContext(ctx,
+		`SELECT count(*) FROM login_failures WHERE ip_address = $1 AND created_at > $2`,
+		ip, since,
+	).Scan(&attempt.IPFailures)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO login_failures (email, ip_address) VALUES ($1, $2) RETURNING id`,
+		email, ip,
+	).Scan(&attempt.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	attempt.Failures++
+	attempt.IPFailures++
+
+	return &attempt, nil
+}
+
+// ReleaseLoginAttempt removes a reserved attempt that turned out not to be
+// a failure.
+func (m *PostgresDBRepo) ReleaseLoginAttempt(id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM login_failures WHERE id = $1`, id)
+	return err
+}
+
+// CountLoginFailures returns how many failed attempts were made against
+// email since the given time, and when the latest one happened.
+func (m *PostgresDBRepo) CountLoginFailures(email string, since time.Time) (int, time.Time, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT count(*), max(created_at)
+		FROM login_failures
+		WHERE email = $1 AND created_at > $2
+	`
+
+	var count int
+	var last sql.NullTime
+
+	err := m.DB.QueryRowContext(ctx, query, email, since).Scan(&count, &last)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	return count, last.Time, nil
+}
+
+// LockAccount blocks sign-in for email until the given time.
+func (m *PostgresDBRepo) LockAccount(email string, until time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO account_lockouts (email, locked_until) VALUES ($1, $2)
+		ON CONFLICT (email) DO UPDATE SET locked_until = EXCLUDED.locked_until
+	`
+
+	_, err := m.DB.ExecContext(ctx, query, email, until)
+	return err
+}
+
+// GetAccountLockout returns when the lockout on email ends, or nil when the
+// account is not locked.
+func (m *PostgresDBRepo) GetAccountLockout(email string) (*time.Time, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `SELECT locked_until FROM account_lockouts WHERE email = $1 AND locked_until > now()`
+
+	var until time.Time
+
+	err := m.DB.QueryRowContext(ctx, query, email).Scan(&until)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &until, nil
+}
+
+// ClearLoginFailures forgets the failed attempts against email and lifts
+// any lockout.
+func (m *PostgresDBRepo) ClearLoginFailures(email string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM login_failures WHERE email = $1`, email); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM account_lockouts WHERE email = $1`, email); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
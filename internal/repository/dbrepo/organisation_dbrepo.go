@@ -0,0 +1,258 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/golangnigeria/liveright_backend/internal/models"
+)
+
+// InsertOrganisation creates a partner organisation.
+func (m *PostgresDBRepo) InsertOrganisation(org *models.Organisation) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `INSERT INTO organisations (name, kind) VALUES ($1, $2) RETURNING id, created_at`
+
+	return m.DB.QueryRowContext(ctx, query, org.Name, org.Kind).Scan(&org.ID, &org.CreatedAt)
+}
+
+// AllOrganisations lists every partner organisation.
+func (m *PostgresDBRepo) AllOrganisations() ([]*models.Organisation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `SELECT id, name, kind, created_at FROM organisations ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orgs []*models.Organisation
+	for rows.Next() {
+		var org models.Organisation
+		if err := rows.Scan(&org.ID, &org.Name, &org.Kind, &org.CreatedAt); err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, &org)
+	}
+
+	return orgs, rows.Err()
+}
+
+// GetOrganisationByID returns one organisation or sql.ErrNoRows.
+func (m *PostgresDBRepo) GetOrganisationByID(id int64) (*models.Organisation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `SELECT id, name, kind, created_at FROM organisations WHERE id = $1`
+
+	var org models.Organisation
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&org.ID, &org.Name, &org.Kind, &org.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, err
+	}
+
+	return &org, nil
+}
+
+// apiKeyColumns lists the api_keys columns read by scanAPIKey, in order.
+const apiKeyColumns = `
+	id, organisation_id, name, prefix, key_hash, scopes, created_by,
+	created_at, last_used_at, expires_at, revoked_at
+`
+
+// scanAPIKey reads a row selected with apiKeyColumns.
+func scanAPIKey(row interface{ Scan(dest ...any) error }) (*models.APIKey, error) {
+	var key models.APIKey
+	var scopes string
+	var createdBy sql.NullInt64
+	var lastUsedAt, expiresAt, revokedAt sql.NullTime
+
+	err := row.Scan(
+		&key.ID,
+		&key.OrganisationID,
+		&key.Name,
+		&key.Prefix,
+		&key.KeyHash,
+		&scopes,
+		&createdBy,
+		&key.CreatedAt,
+		&lastUsedAt,
+		&expiresAt,
+		&revokedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, err
+	}
+
+	key.Scopes = strings.Fields(scopes)
+	if createdBy.Valid {
+		key.CreatedBy = &createdBy.Int64
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+
+	return &key, nil
+}
+
+// insertAPIKey stores key using q, which may be the pool or a transaction.
+func insertAPIKey(ctx context.Context, q interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}, key *models.APIKey) error {
+	var createdBy sql.NullInt64
+	if key.CreatedBy != nil {
+		createdBy = sql.NullInt64{Int64: *key.CreatedBy, Valid: true}
+	}
+
+	query := `
+		INSERT INTO api_keys (organisation_id, name, prefix, key_hash, scopes, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+
+	return q.QueryRowContext(ctx, query,
+		key.OrganisationID,
+		key.Name,
+		key.Prefix,
+		key.KeyHash,
+		strings.Join(key.Scopes, " "),
+		createdBy,
+	).Scan(&key.ID, &key.CreatedAt)
+}
+
+// InsertAPIKey stores a newly created API key.
+func (m *PostgresDBRepo) InsertAPIKey(key *models.APIKey) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return insertAPIKey(ctx, m.DB, key)
+}
+
+// GetAPIKeyByPrefix returns the key with prefix, whatever its state, or
+// sql.ErrNoRows.
+func (m *PostgresDBRepo) GetAPIKeyByPrefix(prefix string) (*models.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE prefix = $1`
+
+	return scanAPIKey(m.DB.QueryRowContext(ctx, query, prefix))
+}
+
+// GetAPIKey returns one of an organisation's keys or sql.ErrNoRows.
+func (m *PostgresDBRepo) GetAPIKey(orgID, id int64) (*models.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE organisation_id = $1 AND id = $2`
+
+	return scanAPIKey(m.DB.QueryRowContext(ctx, query, orgID, id))
+}
+
+// GetAPIKeysForOrganisation lists an organisation's keys, newest first,
+// including revoked and expired ones.
+func (m *PostgresDBRepo) GetAPIKeysForOrganisation(orgID int64) ([]*models.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE organisation_id = $1 ORDER BY created_at DESC`
+
+	rows, err := m.DB.QueryContext(ctx, query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*models.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// RotateAPIKey stores replacement and makes the old key expire at
+// oldExpiresAt, unless it already expires sooner, in one transaction. It
+// returns sql.ErrNoRows if the old key does not belong to the organisation
+// or has been revoked.
+func (m *PostgresDBRepo) RotateAPIKey(orgID, oldID int64, oldExpiresAt time.Time, replacement *models.APIKey) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE api_keys SET expires_at = LEAST(COALESCE(expires_at, $3), $3)
+		WHERE organisation_id = $1 AND id = $2 AND revoked_at IS NULL
+	`
+
+	result, err := tx.ExecContext(ctx, query, orgID, oldID, oldExpiresAt)
+	if err != nil {
+		return err
+	}
+	if err := expectOneRow(result); err != nil {
+		return err
+	}
+
+	if err := insertAPIKey(ctx, tx, replacement); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RevokeAPIKey revokes one of an organisation's keys. It returns
+// sql.ErrNoRows if there is no such unrevoked key.
+func (m *PostgresDBRepo) RevokeAPIKey(orgID, id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `UPDATE api_keys SET revoked_at = now() WHERE organisation_id = $1 AND id = $2 AND revoked_at IS NULL`
+
+	result, err := m.DB.ExecContext(ctx, query, orgID, id)
+	if err != nil {
+		return err
+	}
+	return expectOneRow(result)
+}
+
+// TouchAPIKey records that a key was just used. Writes are limited to one a
+// minute per key so busy integrations do not write on every request.
+func (m *PostgresDBRepo) TouchAPIKey(id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE api_keys SET last_used_at = now()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < now() - interval '1 minute')
+	`
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return err
+}
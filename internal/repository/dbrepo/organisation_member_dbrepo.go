@@ -0,0 +1,330 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/golangnigeria/liveright_backend/internal/models"
+	"github.com/golangnigeria/liveright_backend/internal/repository"
+)
+
+// memberQuery selects organisation members joined with their user
+// accounts, in the order read by scanMember.
+const memberQuery = `
+	SELECT m.organisation_id, m.user_id, u.first_name, u.last_name, u.email,
+		m.is_admin, m.created_at
+	FROM organisation_members m
+	JOIN users u ON u.id = m.user_id
+`
+
+// scanMember reads a row selected with memberQuery.
+func scanMember(row interface{ Scan(dest ...any) error }) (*models.OrganisationMember, error) {
+	var member models.OrganisationMember
+
+	err := row.Scan(
+		&member.OrganisationID,
+		&member.UserID,
+		&member.FirstName,
+		&member.LastName,
+		&member.Email,
+		&member.IsAdmin,
+		&member.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, err
+	}
+
+	return &member, nil
+}
+
+// GetOrganisationMembership returns the organisation membership of a user,
+// or sql.ErrNoRows if they are not staff of any organisation.
+func (m *PostgresDBRepo) GetOrganisationMembership(userID int64) (*models.OrganisationMember, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return scanMember(m.DB.QueryRowContext(ctx, memberQuery+` WHERE m.user_id = $1`, userID))
+}
+
+// GetOrganisationMembers lists an organisation's staff.
+func (m *PostgresDBRepo) GetOrganisationMembers(orgID int64) ([]*models.OrganisationMember, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, memberQuery+` WHERE m.organisation_id = $1 ORDER BY u.last_name, u.first_name`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []*models.OrganisationMember
+	for rows.Next() {
+		member, err := scanMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+
+	return members, rows.Err()
+}
+
+// RemoveOrganisationMember removes a member and deactivates their account,
+// which only existed to work for the organisation. It returns
+// sql.ErrNoRows if the user is not a member.
+func (m *PostgresDBRepo) RemoveOrganisationMember(orgID, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx,
+		`DELETE FROM organisation_members WHERE organisation_id = $1 AND user_id = $2`,
+		orgID, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if err := expectOneRow(result); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET active = FALSE WHERE id = $1`, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// invitationColumns lists the organisation_invitations columns read by
+// scanInvitation, in order.
+const invitationColumns = `
+	id, organisation_id, email, is_admin, token_hash, invited_by, expires_at,
+	accepted_at, created_at
+`
+
+// scanInvitation reads a row selected with invitationColumns.
+func scanInvitation(row interface{ Scan(dest ...any) error }) (*models.OrganisationInvitation, error) {
+	var inv models.OrganisationInvitation
+	var invitedBy sql.NullInt64
+	var acceptedAt sql.NullTime
+
+	err := row.Scan(
+		&inv.ID,
+		&inv.OrganisationID,
+		&inv.Email,
+		&inv.IsAdmin,
+		&inv.TokenHash,
+		&invitedBy,
+		&inv.ExpiresAt,
+		&acceptedAt,
+		&inv.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, err
+	}
+
+	if invitedBy.Valid {
+		inv.InvitedBy = &invitedBy.Int64
+	}
+	if acceptedAt.Valid {
+		inv.AcceptedAt = &acceptedAt.Time
+	}
+
+	return &inv, nil
+}
+
+// InsertOrganisationInvitation stores an invitation, replacing any pending
+// invitation to the same email from the same organisation.
+func (m *PostgresDBRepo) InsertOrganisationInvitation(inv *models.OrganisationInvitation) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		`DELETE FROM organisation_invitations WHERE organisation_id = $1 AND email = $2 AND accepted_at IS NULL`,
+		inv.OrganisationID, inv.Email,
+	)
+	if err != nil {
+		return err
+	}
+
+	var invitedBy sql.NullInt64
+	if inv.InvitedBy != nil {
+		invitedBy = sql.NullInt64{Int64: *inv.InvitedBy, Valid: true}
+	}
+
+	query := `
+		INSERT INTO organisation_invitations (organisation_id, email, is_admin, token_hash, invited_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+
+	err = tx.QueryRowContext(ctx, query,
+		inv.OrganisationID,
+		inv.Email,
+		inv.IsAdmin,
+		inv.TokenHash,
+		invitedBy,
+		inv.ExpiresAt,
+	).Scan(&inv.ID, &inv.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetPendingOrganisationInvitations lists an organisation's invitations
+// that have not been accepted, including expired ones.
+func (m *PostgresDBRepo) GetPendingOrganisationInvitations(orgID int64) ([]*models.OrganisationInvitation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT ` + invitationColumns + ` FROM organisation_invitations
+		WHERE organisation_id = $1 AND accepted_at IS NULL
+		ORDER BY created_at DESC
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invitations []*models.OrganisationInvitation
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, inv)
+	}
+
+	return invitations, rows.Err()
+}
+
+// GetValidOrganisationInvitation returns an unaccepted, unexpired
+// invitation without accepting it, or sql.ErrNoRows.
+func (m *PostgresDBRepo) GetValidOrganisationInvitation(hash []byte) (*models.OrganisationInvitation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT ` + invitationColumns + ` FROM organisation_invitations
+		WHERE token_hash = $1 AND accepted_at IS NULL AND expires_at > now()
+	`
+
+	return scanInvitation(m.DB.QueryRowContext(ctx, query, hash))
+}
+
+// DeleteOrganisationInvitation withdraws a pending invitation. It returns
+// sql.ErrNoRows if there is no such pending invitation.
+func (m *PostgresDBRepo) DeleteOrganisationInvitation(orgID, id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `DELETE FROM organisation_invitations WHERE organisation_id = $1 AND id = $2 AND accepted_at IS NULL`
+
+	result, err := m.DB.ExecContext(ctx, query, orgID, id)
+	if err != nil {
+		return err
+	}
+	return expectOneRow(result)
+}
+
+// AcceptOrganisationInvitation accepts a valid invitation and creates the
+// invitee's staff account in one transaction. The account gets the email
+// from the invitation, already verified, the role matching the
+// organisation's kind and its membership. Unknown, accepted and expired
+// invitations yield sql.ErrNoRows; an email that is already registered
+// yields repository.ErrDuplicate.
+func (m *PostgresDBRepo) AcceptOrganisationInvitation(hash []byte, user *models.User) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var orgID int64
+	var isAdmin bool
+
+	err = tx.QueryRowContext(ctx, `
+		UPDATE organisation_invitations SET accepted_at = now()
+		WHERE token_hash = $1 AND accepted_at IS NULL AND expires_at > now()
+		RETURNING organisation_id, email, is_admin
+	`, hash).Scan(&orgID, &user.Email, &isAdmin)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, err
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		SELECT r.id FROM organisations o JOIN roles r ON r.name = o.kind WHERE o.id = $1
+	`, orgID).Scan(&user.RoleID.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var phone sql.NullString
+	if user.Phone != nil {
+		phone = sql.NullString{String: *user.Phone, Valid: true}
+	}
+
+	inserted := *user
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO users (first_name, last_name, email, password_hash, role_id, phone, active, email_verified_at)
+		VALUES ($1, $2, $3, $4, $5, $6, TRUE, now())
+		RETURNING id, created_at, email_verified_at
+	`,
+		user.FirstName,
+		user.LastName,
+		user.Email,
+		user.PasswordHash,
+		user.RoleID.ID,
+		phone,
+	).Scan(&inserted.ID, &inserted.CreatedAt, &inserted.EmailVerifiedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, repository.ErrDuplicate
+		}
+		return nil, err
+	}
+	inserted.Active = true
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO organisation_members (organisation_id, user_id, is_admin) VALUES ($1, $2, $3)`,
+		orgID, inserted.ID, isAdmin,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &inserted, nil
+}
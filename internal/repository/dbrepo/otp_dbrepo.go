@@ -0,0 +1,147 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/golangnigeria/liveright_backend/internal/models"
+)
+
+// InsertPhoneOTP stores a newly issued code and invalidates any earlier
+// outstanding code for the same number, so only the latest one works.
+func (m *PostgresDBRepo) InsertPhoneOTP(otp *models.PhoneOTP) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE phone_otps SET used_at = now() WHERE phone = $1 AND used_at IS NULL`,
+		otp.Phone,
+	)
+	if err != nil {
+		return err
+	}
+
+	var userID sql.NullInt64
+	if otp.UserID != nil {
+		userID = sql.NullInt64{Int64: *otp.UserID, Valid: true}
+	}
+
+	query := `
+		INSERT INTO phone_otps (phone, user_id, code_hash, ip_address, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+
+	err = tx.QueryRowContext(ctx, query,
+		otp.Phone,
+		userID,
+		otp.CodeHash,
+		otp.IPAddress,
+		otp.ExpiresAt,
+	).Scan(&otp.ID, &otp.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CountPhoneOTPs returns how many codes were issued for phone since the
+// given time.
+func (m *PostgresDBRepo) CountPhoneOTPs(phone string, since time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `SELECT count(*) FROM phone_otps WHERE phone = $1 AND created_at > $2`
+
+	var count int
+	err := m.DB.QueryRowContext(ctx, query, phone, since).Scan(&count)
+	return count, err
+}
+
+// CountPhoneOTPsByIP returns how many codes were requested from ip since the
+// given time.
+func (m *PostgresDBRepo) CountPhoneOTPsByIP(ip string, since time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `SELECT count(*) FROM phone_otps WHERE ip_address = $1 AND created_at > $2`
+
+	var count int
+	err := m.DB.QueryRowContext(ctx, query, ip, since).Scan(&count)
+	return count, err
+}
+
+// UsePhoneOTPAttempt spends one guess on the latest unused, unexpired code
+// for phone and returns it. The guess is counted before the code is
+// checked, so concurrent guesses cannot exceed maxAttempts. It returns
+// sql.ErrNoRows when there is no such code or its guesses are used up.
+func (m *PostgresDBRepo) UsePhoneOTPAttempt(phone string, maxAttempts int) (*models.PhoneOTP, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE phone_otps SET attempts = attempts + 1
+		WHERE id = (
+			SELECT id FROM phone_otps
+			WHERE phone = $1 AND used_at IS NULL AND expires_at > now()
+			ORDER BY created_at DESC
+			LIMIT 1
+		) AND attempts < $2
+		RETURNING id, phone, user_id, code_hash, attempts, ip_address, expires_at, created_at
+	`
+
+	var otp models.PhoneOTP
+	var userID sql.NullInt64
+
+	err := m.DB.QueryRowContext(ctx, query, phone, maxAttempts).Scan(
+		&otp.ID,
+		&otp.Phone,
+		&userID,
+		&otp.CodeHash,
+		&otp.Attempts,
+		&otp.IPAddress,
+		&otp.ExpiresAt,
+		&otp.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, err
+	}
+
+	if userID.Valid {
+		otp.UserID = &userID.Int64
+	}
+
+	return &otp, nil
+}
+
+// ConsumePhoneOTP marks a code as used. It reports false if the code was
+// already used or has expired, so a code can only be redeemed once.
+func (m *PostgresDBRepo) ConsumePhoneOTP(id int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `UPDATE phone_otps SET used_at = now() WHERE id = $1 AND used_at IS NULL AND expires_at > now()`
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
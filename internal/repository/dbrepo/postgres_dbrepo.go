@@ -26,20 +26,63 @@ func (m *PostgresDBRepo) Connection() *sql.DB {
 	return m.DB
 }
 
+// userColumns lists the users columns read by scanUser, in order.
+const userColumns = `
+	id, created_at, first_name, last_name, email, password_hash, role_id,
+	phone, active, email_verified_at, phone_verified_at
+`
+
 func (m *PostgresDBRepo) GetUserByEmail(email string) (*models.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	query := ` 
-				SELECT id, created_at, first_name, last_name, email, password_hash, role_id,
-				phone, active from users where email = $1
-	`
+	query := `SELECT ` + userColumns + ` FROM users WHERE email = $1`
+
+	return scanUser(m.DB.QueryRowContext(ctx, query, email))
+}
+
+func (m *PostgresDBRepo) GetUserByID(id int64) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+
+	return scanUser(m.DB.QueryRowContext(ctx, query, id))
+}
+
+// GetUsersByPhone returns the active users who have confirmed phone, which
+// must be in E.164 form. Family members sometimes share one number, so
+// there may be more than one.
+func (m *PostgresDBRepo) GetUsersByPhone(phone string) ([]*models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `SELECT ` + userColumns + ` FROM users WHERE phone = $1 AND phone_verified_at IS NOT NULL AND active ORDER BY id`
+
+	rows, err := m.DB.QueryContext(ctx, query, phone)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
 
+// scanUser reads a row selected with userColumns.
+func scanUser(row interface{ Scan(dest ...any) error }) (*models.User, error) {
 	var user models.User
-	var roleID int64
+	var roleID sql.NullInt64
 	var phone sql.NullString
-
-	row := m.DB.QueryRowContext(ctx, query, email)
+	var emailVerifiedAt, phoneVerifiedAt sql.NullTime
 
 	err := row.Scan(
 		&user.ID,
@@ -51,6 +94,8 @@ func (m *PostgresDBRepo) GetUserByEmail(email string) (*models.User, error) {
 		&roleID,
 		&phone,
 		&user.Active,
+		&emailVerifiedAt,
+		&phoneVerifiedAt,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -59,10 +104,39 @@ func (m *PostgresDBRepo) GetUserByEmail(email string) (*models.User, error) {
 		return nil, err
 	}
 
-	user.RoleID = models.Role{ID: roleID}
+	user.RoleID = models.Role{ID: roleID.Int64}
 	if phone.Valid {
 		user.Phone = &phone.String
 	}
+	if emailVerifiedAt.Valid {
+		user.EmailVerifiedAt = &emailVerifiedAt.Time
+	}
+	if phoneVerifiedAt.Valid {
+		user.PhoneVerifiedAt = &phoneVerifiedAt.Time
+	}
 
 	return &user, nil
 }
+
+func (m *PostgresDBRepo) GetRoleByID(id int64) (*models.Role, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `SELECT id, name, created_at FROM roles WHERE id = $1`
+
+	var role models.Role
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&role.ID,
+		&role.Name,
+		&role.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, err
+	}
+
+	return &role, nil
+}
@@ -0,0 +1,200 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/golangnigeria/liveright_backend/internal/models"
+	"github.com/golangnigeria/liveright_backend/internal/repository"
+)
+
+// AllRoles returns every role together with the names of its permissions.
+func (m *PostgresDBRepo) AllRoles() ([]*models.Role, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT r.id, r.name, r.created_at, p.name
+		FROM roles r
+		LEFT JOIN role_permissions rp ON rp.role_id = r.id
+		LEFT JOIN permissions p ON p.id = rp.permission_id
+		ORDER BY r.id, p.name
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []*models.Role
+	var current *models.Role
+
+	for rows.Next() {
+		var role models.Role
+		var permission sql.NullString
+
+		if err := rows.Scan(&role.ID, &role.Name, &role.CreatedAt, &permission); err != nil {
+			return nil, err
+		}
+
+		if current == nil || current.ID != role.ID {
+			current = &role
+			current.Permissions = []string{}
+			roles = append(roles, current)
+		}
+
+		if permission.Valid {
+			current.Permissions = append(current.Permissions, permission.String)
+		}
+	}
+
+	return roles, rows.Err()
+}
+
+// InsertRole creates a new role with no permissions.
+func (m *PostgresDBRepo) InsertRole(name string) (*models.Role, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `INSERT INTO roles (name) VALUES ($1) RETURNING id, name, created_at`
+
+	var role models.Role
+
+	err := m.DB.QueryRowContext(ctx, query, name).Scan(&role.ID, &role.Name, &role.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, repository.ErrDuplicate
+		}
+		return nil, err
+	}
+
+	role.Permissions = []string{}
+
+	return &role, nil
+}
+
+// UpdateUserRole assigns roleID to the given user.
+func (m *PostgresDBRepo) UpdateUserRole(userID, roleID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `UPDATE users SET role_id = $1 WHERE id = $2`
+
+	result, err := m.DB.ExecContext(ctx, query, roleID, userID)
+	if err != nil {
+		return err
+	}
+
+	return expectOneRow(result)
+}
+
+// AllPermissions returns every known permission.
+func (m *PostgresDBRepo) AllPermissions() ([]*models.Permission, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `SELECT id, name, description, created_at FROM permissions ORDER BY name`
+
+	return m.queryPermissions(ctx, query)
+}
+
+// GetPermissionsForRole returns the permissions granted to a role.
+func (m *PostgresDBRepo) GetPermissionsForRole(roleID int64) ([]*models.Permission, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT p.id, p.name, p.description, p.created_at
+		FROM permissions p
+		JOIN role_permissions rp ON rp.permission_id = p.id
+		WHERE rp.role_id = $1
+		ORDER BY p.name
+	`
+
+	return m.queryPermissions(ctx, query, roleID)
+}
+
+func (m *PostgresDBRepo) queryPermissions(ctx context.Context, query string, args ...any) ([]*models.Permission, error) {
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions []*models.Permission
+
+	for rows.Next() {
+		var p models.Permission
+		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, &p)
+	}
+
+	return permissions, rows.Err()
+}
+
+// AttachPermissionToRole grants the named permission to a role. It returns
+// sql.ErrNoRows when the permission does not exist.
+func (m *PostgresDBRepo) AttachPermissionToRole(roleID int64, permission string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var exists bool
+	err := m.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM permissions WHERE name = $1)`, permission).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+
+	query := `
+		INSERT INTO role_permissions (role_id, permission_id)
+		SELECT $1, id FROM permissions WHERE name = $2
+		ON CONFLICT DO NOTHING
+	`
+
+	_, err = m.DB.ExecContext(ctx, query, roleID, permission)
+	return err
+}
+
+// DetachPermissionFromRole removes the named permission from a role.
+func (m *PostgresDBRepo) DetachPermissionFromRole(roleID int64, permission string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		DELETE FROM role_permissions
+		WHERE role_id = $1
+		AND permission_id = (SELECT id FROM permissions WHERE name = $2)
+	`
+
+	result, err := m.DB.ExecContext(ctx, query, roleID, permission)
+	if err != nil {
+		return err
+	}
+
+	return expectOneRow(result)
+}
+
+// UserHasPermission reports whether the user's current role grants permission.
+func (m *PostgresDBRepo) UserHasPermission(userID int64, permission string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM users u
+			JOIN role_permissions rp ON rp.role_id = u.role_id
+			JOIN permissions p ON p.id = rp.permission_id
+			WHERE u.id = $1 AND p.name = $2
+		)
+	`
+
+	var allowed bool
+	err := m.DB.QueryRowContext(ctx, query, userID, permission).Scan(&allowed)
+	return allowed, err
+}
@@ -0,0 +1,111 @@
+package dbrepo
+
+import (
+	"context"
+
+	"github.com/golangnigeria/liveright_backend/internal/models"
+)
+
+// InsertSession records a new signed-in device.
+func (m *PostgresDBRepo) InsertSession(session *models.Session) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO sessions (id, user_id, user_agent, ip_address)
+		VALUES ($1, $2, $3, $4)
+		RETURNING created_at, last_used_at
+	`
+
+	return m.DB.QueryRowContext(ctx, query,
+		session.ID,
+		session.UserID,
+		session.UserAgent,
+		session.IPAddress,
+	).Scan(&session.CreatedAt, &session.LastUsedAt)
+}
+
+// TouchSession updates when and from where a session was last used.
+func (m *PostgresDBRepo) TouchSession(id, ip, userAgent string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE sessions SET last_used_at = now(), ip_address = $2, user_agent = $3
+		WHERE id = $1
+	`
+
+	_, err := m.DB.ExecContext(ctx, query, id, ip, userAgent)
+	return err
+}
+
+// GetSessionsForUser returns the user's live sessions, most recently used
+// first. Sessions whose refresh tokens have all expired are left out.
+func (m *PostgresDBRepo) GetSessionsForUser(userID int64) ([]*models.Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT s.id, s.user_id, s.user_agent, s.ip_address, s.created_at, s.last_used_at
+		FROM sessions s
+		WHERE s.user_id = $1 AND s.revoked_at IS NULL
+		AND EXISTS (
+			SELECT 1 FROM refresh_tokens rt
+			WHERE rt.family_id = s.id AND rt.revoked_at IS NULL AND rt.expires_at > now()
+		)
+		ORDER BY s.last_used_at DESC
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*models.Session
+
+	for rows.Next() {
+		var s models.Session
+		err := rows.Scan(&s.ID, &s.UserID, &s.UserAgent, &s.IPAddress, &s.CreatedAt, &s.LastUsedAt)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &s)
+	}
+
+	return sessions, rows.Err()
+}
+
+// RevokeSession ends one of the user's sessions and revokes its refresh
+// tokens. It returns sql.ErrNoRows when the user has no such live session.
+func (m *PostgresDBRepo) RevokeSession(userID int64, id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx,
+		`UPDATE sessions SET revoked_at = now() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`,
+		id, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if err := expectOneRow(result); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE refresh_tokens SET revoked_at = now() WHERE family_id = $1 AND revoked_at IS NULL`,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -16,9 +16,13 @@
 package dbrepo
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"time"
 
 	"github.com/golangnigeria/liveright_backend/internal/models"
+	"github.com/golangnigeria/liveright_backend/internal/repository"
 )
 
 func (m *PostgresDBRepo) InsertUser(user *models.User) (*models.User, error) {
@@ -45,6 +49,9 @@ func (m *PostgresDBRepo) InsertUser(user *models.User) (*models.User, error) {
 		user.Active,
 	).Scan(&inserted.ID, &inserted.CreatedAt)
 	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, repository.ErrDuplicate
+		}
 		return nil, err
 	}
 
@@ -60,3 +67,305 @@ func (m *PostgresDBRepo) InsertUser(user *models.User) (*models.User, error) {
 	}
 	return &inserted, nil
 }
+
+func (m *PostgresDBRepo) UpdateUserPassword(userID int64, passwordHash []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `UPDATE users SET password_hash = $1 WHERE id = $2`
+
+	result, err := m.DB.ExecContext(ctx, query, passwordHash, userID)
+	if err != nil {
+		return err
+	}
+
+	return expectOneRow(result)
+}
+
+// CountPasswordHashes returns how many active users have an argon2id
+// password hash and how many have a bcrypt one.
+func (m *PostgresDBRepo) CountPasswordHashes() (argon2id int, bcrypt int, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT
+			count(*) FILTER (WHERE position('$argon2id$'::bytea IN password_hash) = 1),
+			count(*) FILTER (WHERE position('$2'::bytea IN password_hash) = 1)
+		FROM users
+		WHERE active
+	`
+
+	err = m.DB.QueryRowContext(ctx, query).Scan(&argon2id, &bcrypt)
+	return argon2id, bcrypt, err
+}
+
+func (m *PostgresDBRepo) SetEmailVerified(userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `UPDATE users SET email_verified_at = now() WHERE id = $1 AND email_verified_at IS NULL`
+
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
+
+// UpdateUser saves a user's name. Email, phone, password and role have
+// their own flows and are not touched.
+func (m *PostgresDBRepo) UpdateUser(user *models.User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `UPDATE users SET first_name = $1, last_name = $2 WHERE id = $3`
+
+	result, err := m.DB.ExecContext(ctx, query, user.FirstName, user.LastName, user.ID)
+	if err != nil {
+		return err
+	}
+
+	return expectOneRow(result)
+}
+
+// InsertEmailChange stores a requested email change, replacing any earlier
+// pending request by the same user.
+func (m *PostgresDBRepo) InsertEmailChange(change *models.EmailChange) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM email_changes WHERE user_id = $1 AND used_at IS NULL`, change.UserID); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO email_changes (user_id, new_email, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+
+	err = tx.QueryRowContext(ctx, query,
+		change.UserID,
+		change.NewEmail,
+		change.TokenHash,
+		change.ExpiresAt,
+	).Scan(&change.ID, &change.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ConfirmEmailChange applies a pending email change in one transaction: the
+// request is marked used and the user's email replaced and marked
+// verified. Unknown, used and expired requests yield sql.ErrNoRows; a new
+// address registered in the meantime yields repository.ErrDuplicate.
+func (m *PostgresDBRepo) ConfirmEmailChange(hash []byte) (*models.EmailChange, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE email_changes SET used_at = now()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now()
+		RETURNING id, user_id, new_email, token_hash, expires_at, used_at, created_at
+	`
+
+	var change models.EmailChange
+	var usedAt sql.NullTime
+
+	err = tx.QueryRowContext(ctx, query, hash).Scan(
+		&change.ID,
+		&change.UserID,
+		&change.NewEmail,
+		&change.TokenHash,
+		&change.ExpiresAt,
+		&usedAt,
+		&change.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, err
+	}
+
+	if usedAt.Valid {
+		change.UsedAt = &usedAt.Time
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE users SET email = $1, email_verified_at = now() WHERE id = $2`,
+		change.NewEmail, change.UserID,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, repository.ErrDuplicate
+		}
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &change, nil
+}
+
+// InsertPhoneChange stores a requested phone change, replacing any earlier
+// pending request by the same user.
+func (m *PostgresDBRepo) InsertPhoneChange(change *models.PhoneChange) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE phone_changes SET used_at = now() WHERE user_id = $1 AND used_at IS NULL`,
+		change.UserID,
+	)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO phone_changes (user_id, new_phone, code_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+
+	err = tx.QueryRowContext(ctx, query,
+		change.UserID,
+		change.NewPhone,
+		change.CodeHash,
+		change.ExpiresAt,
+	).Scan(&change.ID, &change.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CountPhoneChanges returns how many phone change codes were sent for the
+// user or to phone since the given time.
+func (m *PostgresDBRepo) CountPhoneChanges(userID int64, phone string, since time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `SELECT count(*) FROM phone_changes WHERE (user_id = $1 OR new_phone = $2) AND created_at > $3`
+
+	var count int
+	err := m.DB.QueryRowContext(ctx, query, userID, phone, since).Scan(&count)
+	return count, err
+}
+
+// UsePhoneChangeAttempt spends one guess on the user's pending phone
+// change and returns it. The guess is counted before the code is checked,
+// so concurrent guesses cannot exceed maxAttempts. It returns sql.ErrNoRows
+// when there is no unused, unexpired change with guesses left.
+func (m *PostgresDBRepo) UsePhoneChangeAttempt(userID int64, maxAttempts int) (*models.PhoneChange, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE phone_changes SET attempts = attempts + 1
+		WHERE id = (
+			SELECT id FROM phone_changes
+			WHERE user_id = $1 AND used_at IS NULL AND expires_at > now()
+			ORDER BY created_at DESC
+			LIMIT 1
+		) AND attempts < $2
+		RETURNING id, user_id, new_phone, code_hash, attempts, expires_at, created_at
+	`
+
+	var change models.PhoneChange
+
+	err := m.DB.QueryRowContext(ctx, query, userID, maxAttempts).Scan(
+		&change.ID,
+		&change.UserID,
+		&change.NewPhone,
+		&change.CodeHash,
+		&change.Attempts,
+		&change.ExpiresAt,
+		&change.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, err
+	}
+
+	return &change, nil
+}
+
+// ConfirmPhoneChange applies a pending phone change in one transaction: the
+// request is marked used and the user's phone replaced and marked
+// verified. A used or expired request yields sql.ErrNoRows.
+func (m *PostgresDBRepo) ConfirmPhoneChange(id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE phone_changes SET used_at = now()
+		WHERE id = $1 AND used_at IS NULL AND expires_at > now()
+		RETURNING user_id, new_phone
+	`
+
+	var userID int64
+	var phone string
+
+	err = tx.QueryRowContext(ctx, query, id).Scan(&userID, &phone)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return sql.ErrNoRows
+		}
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE users SET phone = $1, phone_verified_at = now() WHERE id = $2`,
+		phone, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RemoveUserPhone clears a user's phone number.
+func (m *PostgresDBRepo) RemoveUserPhone(userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `UPDATE users SET phone = NULL, phone_verified_at = NULL WHERE id = $1`
+
+	result, err := m.DB.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	return expectOneRow(result)
+}
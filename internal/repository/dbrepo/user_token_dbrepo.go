@@ -0,0 +1,149 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/golangnigeria/liveright_backend/internal/models"
+)
+
+// InsertUserToken stores a newly issued single-use token.
+func (m *PostgresDBRepo) InsertUserToken(token *models.UserToken) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+
+	return m.DB.QueryRowContext(ctx, query,
+		token.UserID,
+		token.Purpose,
+		token.TokenHash,
+		token.ExpiresAt,
+	).Scan(&token.ID, &token.CreatedAt)
+}
+
+// GetValidUserToken returns an unused, unexpired token without consuming it,
+// or sql.ErrNoRows.
+func (m *PostgresDBRepo) GetValidUserToken(hash []byte, purpose string) (*models.UserToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT id, user_id, purpose, token_hash, expires_at, created_at
+		FROM user_tokens
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > now()
+	`
+
+	var token models.UserToken
+
+	err := m.DB.QueryRowContext(ctx, query, hash, purpose).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Purpose,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&token.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// ConsumeUserToken marks an unused, unexpired token as used and returns it.
+// Marking and checking happen in one statement, so a token can only ever be
+// consumed once. Unknown, used and expired tokens yield sql.ErrNoRows.
+func (m *PostgresDBRepo) ConsumeUserToken(hash []byte, purpose string) (*models.UserToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE user_tokens SET used_at = now()
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > now()
+		RETURNING id, user_id, purpose, token_hash, expires_at, used_at, created_at
+	`
+
+	var token models.UserToken
+	var usedAt sql.NullTime
+
+	err := m.DB.QueryRowContext(ctx, query, hash, purpose).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Purpose,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&usedAt,
+		&token.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, err
+	}
+
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+
+	return &token, nil
+}
+
+// DeleteUserTokens removes every outstanding token a user holds for purpose.
+func (m *PostgresDBRepo) DeleteUserTokens(userID int64, purpose string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `DELETE FROM user_tokens WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`
+
+	_, err := m.DB.ExecContext(ctx, query, userID, purpose)
+	return err
+}
+
+// InsertMagicLinkRequest records that a sign-in link was asked for, whether
+// or not email belongs to an account, so send limits apply evenly.
+func (m *PostgresDBRepo) InsertMagicLinkRequest(email, ip string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `INSERT INTO magic_link_requests (email, ip_address) VALUES (lower($1), $2)`
+
+	_, err := m.DB.ExecContext(ctx, query, email, ip)
+	return err
+}
+
+// CountMagicLinkRequests returns how many sign-in links were asked for to
+// email since the given time.
+func (m *PostgresDBRepo) CountMagicLinkRequests(email string, since time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `SELECT count(*) FROM magic_link_requests WHERE email = lower($1) AND created_at > $2`
+
+	var count int
+	err := m.DB.QueryRowContext(ctx, query, email, since).Scan(&count)
+	return count, err
+}
+
+// CountMagicLinkRequestsByIP returns how many sign-in links were asked for
+// from ip since the given time.
+func (m *PostgresDBRepo) CountMagicLinkRequestsByIP(ip string, since time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `SELECT count(*) FROM magic_link_requests WHERE ip_address = $1 AND created_at > $2`
+
+	var count int
+	err := m.DB.QueryRowContext(ctx, query, ip, since).Scan(&count)
+	return count, err
+}
@@ -6,15 +6,131 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
+	"time"
 
 	"github.com/golangnigeria/liveright_backend/internal/models"
 )
 
+// ErrDuplicate is returned when an insert or update would violate a
+// uniqueness constraint.
+var ErrDuplicate = errors.New("record already exists")
+
 // DatabaseRepo describes the set of methods required for interacting with
 // the application's data storage layer. Concrete implementations may use
 // PostgreSQL, MongoDB, or any other database engine.
 type DatabaseRepo interface {
 	Connection() *sql.DB
 	GetUserByEmail(email string) (*models.User, error)
+	GetUserByID(id int64) (*models.User, error)
+	GetUsersByPhone(phone string) ([]*models.User, error)
 	InsertUser(user *models.User) (*models.User, error)
+	UpdateUser(user *models.User) error
+	UpdateUserPassword(userID int64, passwordHash []byte) error
+	CountPasswordHashes() (argon2id int, bcrypt int, err error)
+	SetEmailVerified(userID int64) error
+	GetRoleByID(id int64) (*models.Role, error)
+	AllRoles() ([]*models.Role, error)
+	InsertRole(name string) (*models.Role, error)
+	UpdateUserRole(userID, roleID int64) error
+
+	AllPermissions() ([]*models.Permission, error)
+	GetPermissionsForRole(roleID int64) ([]*models.Permission, error)
+	AttachPermissionToRole(roleID int64, permission string) error
+	DetachPermissionFromRole(roleID int64, permission string) error
+	UserHasPermission(userID int64, permission string) (bool, error)
+
+	InsertRefreshToken(token *models.RefreshToken) error
+	GetRefreshTokenByHash(hash []byte) (*models.RefreshToken, error)
+	RotateRefreshToken(hash []byte) (bool, error)
+	RevokeRefreshTokenFamily(familyID string) error
+	RevokeAllRefreshTokens(userID int64) error
+	RevokeOtherRefreshTokens(userID int64, keepSessionID string) error
+
+	InsertSession(session *models.Session) error
+	TouchSession(id, ip, userAgent string) error
+	GetSessionsForUser(userID int64) ([]*models.Session, error)
+	RevokeSession(userID int64, id string) error
+
+	InsertEmailChange(change *models.EmailChange) error
+	ConfirmEmailChange(hash []byte) (*models.EmailChange, error)
+
+	InsertPhoneChange(change *models.PhoneChange) error
+	CountPhoneChanges(userID int64, phone string, since time.Time) (int, error)
+	UsePhoneChangeAttempt(userID int64, maxAttempts int) (*models.PhoneChange, error)
+	ConfirmPhoneChange(id int64) error
+	RemoveUserPhone(userID int64) error
+
+	InsertUserToken(token *models.UserToken) error
+	GetValidUserToken(hash []byte, purpose string) (*models.UserToken, error)
+	ConsumeUserToken(hash []byte, purpose string) (*models.UserToken, error)
+	DeleteUserTokens(userID int64, purpose string) error
+	InsertMagicLinkRequest(email, ip string) error
+	CountMagicLinkRequests(email string, since time.Time) (int, error)
+	CountMagicLinkRequestsByIP(ip string, since time.Time) (int, error)
+
+	UpsertTOTP(userID int64, secret []byte) error
+	GetTOTP(userID int64) (*models.TOTP, error)
+	ConfirmTOTP(userID int64, recoveryCodeHashes [][]byte) error
+	DeleteTOTP(userID int64) error
+	UseTOTPStep(userID, step int64) (bool, error)
+	UseRecoveryCode(userID int64, codeHash []byte) (bool, error)
+
+	InsertPhoneOTP(otp *models.PhoneOTP) error
+	CountPhoneOTPs(phone string, since time.Time) (int, error)
+	CountPhoneOTPsByIP(ip string, since time.Time) (int, error)
+	UsePhoneOTPAttempt(phone string, maxAttempts int) (*models.PhoneOTP, error)
+	ConsumePhoneOTP(id int64) (bool, error)
+
+	ReserveLoginAttempt(email, ip string, since time.Time) (*models.LoginAttempt, error)
+	ReleaseLoginAttempt(id int64) error
+	CountLoginFailures(email string, since time.Time) (int, time.Time, error)
+	LockAccount(email string, until time.Time) error
+	GetAccountLockout(email string) (*time.Time, error)
+	ClearLoginFailures(email string) error
+
+	InsertAuditEntry(entry *models.AuditEntry) error
+	GetAuditEntriesForUser(userID int64) ([]*models.AuditEntry, error)
+
+	InsertAccountDeletion(deletion *models.AccountDeletion) error
+	GetPendingAccountDeletion(userID int64) (*models.AccountDeletion, error)
+	CancelAccountDeletion(userID int64) error
+	GetDueAccountDeletions(limit int) ([]*models.AccountDeletion, error)
+	AnonymiseUser(deletion *models.AccountDeletion, certificate *models.AuditEntry) error
+
+	InsertDataExport(export *models.DataExport) error
+	GetDataExport(userID, id int64) (*models.DataExport, error)
+	GetPendingDataExports(limit int) ([]*models.DataExport, error)
+	CompleteDataExport(id int64, archive []byte, expiresAt time.Time) error
+	FailDataExport(id int64) error
+	SetDataExportDownloadToken(id int64, hash []byte, expiresAt time.Time) error
+	GetDataExportByDownloadToken(hash []byte) (*models.DataExport, error)
+	ExpireDataExports() error
+
+	InsertDoctor(user *models.User, doctor *models.Doctor) (*models.User, error)
+	LicenceNumberRegistered(licence string) (bool, error)
+	GetDoctor(userID int64) (*models.Doctor, error)
+	GetDoctorsByStatus(status string) ([]*models.Doctor, error)
+	ReviewDoctor(userID int64, status string, reason *string, reviewerID int64) error
+
+	InsertOrganisation(org *models.Organisation) error
+	AllOrganisations() ([]*models.Organisation, error)
+	GetOrganisationByID(id int64) (*models.Organisation, error)
+
+	GetOrganisationMembership(userID int64) (*models.OrganisationMember, error)
+	GetOrganisationMembers(orgID int64) ([]*models.OrganisationMember, error)
+	RemoveOrganisationMember(orgID, userID int64) error
+	InsertOrganisationInvitation(inv *models.OrganisationInvitation) error
+	GetPendingOrganisationInvitations(orgID int64) ([]*models.OrganisationInvitation, error)
+	GetValidOrganisationInvitation(hash []byte) (*models.OrganisationInvitation, error)
+	DeleteOrganisationInvitation(orgID, id int64) error
+	AcceptOrganisationInvitation(hash []byte, user *models.User) (*models.User, error)
+
+	InsertAPIKey(key *models.APIKey) error
+	GetAPIKeyByPrefix(prefix string) (*models.APIKey, error)
+	GetAPIKey(orgID, id int64) (*models.APIKey, error)
+	GetAPIKeysForOrganisation(orgID int64) ([]*models.APIKey, error)
+	RotateAPIKey(orgID, oldID int64, oldExpiresAt time.Time, replacement *models.APIKey) error
+	RevokeAPIKey(orgID, id int64) error
+	TouchAPIKey(id int64) error
 }
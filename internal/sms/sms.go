@@ -0,0 +1,75 @@
+// Package sms defines how the application sends text messages. Handlers
+// depend only on the Sender interface so the SMS provider can be swapped
+// between local development, tests and production.
+package sms
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// Message is a text message to a phone number in E.164 format.
+type Message struct {
+	To   string
+	Body string
+}
+
+// Sender delivers text messages.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogSender writes messages to a logger instead of sending them. It is
+// intended for local development, where codes in the message can be copied
+// straight out of the server log.
+type LogSender struct {
+	Logger *log.Logger
+}
+
+// Send logs msg.
+func (s *LogSender) Send(ctx context.Context, msg Message) error {
+	logger := s.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	logger.Printf("sms to=%q\n%s", msg.To, msg.Body)
+	return nil
+}
+
+// FakeSender keeps sent messages in memory so tests can read them back.
+type FakeSender struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// Send records msg.
+func (s *FakeSender) Send(ctx context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+// Messages returns every message sent so far, oldest first.
+func (s *FakeSender) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Message(nil), s.messages...)
+}
+
+// Last returns the most recent message sent to the given number.
+func (s *FakeSender) Last(to string) (Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		if s.messages[i].To == to {
+			return s.messages[i], true
+		}
+	}
+	return Message{}, false
+}
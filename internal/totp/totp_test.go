@@ -0,0 +1,108 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 seed from RFC 6238 appendix B.
+var rfcSecret = []byte("12345678901234567890")
+
+func TestCodeRFC6238(t *testing.T) {
+	// The RFC lists eight digit codes; six digit codes are their last six
+	// digits.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		got := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if got != tt.want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	tests := []struct {
+		name   string
+		offset int64
+		skew   int
+		want   bool
+	}{
+		{"current step", 0, 0, true},
+		{"previous step without skew", -1, 0, false},
+		{"previous step", -1, 1, true},
+		{"next step", 1, 1, true},
+		{"two steps behind", -2, 1, false},
+		{"two steps ahead", 2, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, Code(rfcSecret, current+tt.offset), now, tt.skew)
+			if ok != tt.want {
+				t.Fatalf("Validate ok = %v, want %v", ok, tt.want)
+			}
+			if ok && step != current+tt.offset {
+				t.Errorf("Validate step = %d, want %d", step, current+tt.offset)
+			}
+		})
+	}
+}
+
+func TestValidateRejectsMalformedCodes(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code := Code(rfcSecret, Step(now))
+
+	tests := []struct {
+		name string
+		code string
+	}{
+		{"empty", ""},
+		{"too short", code[:5]},
+		{"too long", code + "0"},
+		{"wrong code", "000000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := Validate(rfcSecret, tt.code, now, 1); ok {
+				t.Errorf("Validate(%q) accepted", tt.code)
+			}
+		})
+	}
+}
+
+// Validate reports the step a code belongs to so callers can refuse it a
+// second time. Checking the same code later within the skew must name the
+// same step.
+func TestValidateReportsStepForReplay(t *testing.T) {
+	issued := time.Unix(1111111111, 0)
+	code := Code(rfcSecret, Step(issued))
+
+	first, ok := Validate(rfcSecret, code, issued, 1)
+	if !ok {
+		t.Fatal("code rejected when issued")
+	}
+
+	replayed, ok := Validate(rfcSecret, code, issued.Add(Period), 1)
+	if !ok {
+		t.Fatal("code rejected one period later")
+	}
+
+	if first != replayed {
+		t.Errorf("replayed code matched step %d, first use matched %d", replayed, first)
+	}
+}
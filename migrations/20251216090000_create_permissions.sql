@@ -0,0 +1,31 @@
+-- +goose Up
+-- Roles were seeded with explicit ids, so move the sequence past them before
+-- any role is created through the API.
+SELECT setval('roles_id_seq', (SELECT MAX(id) FROM roles));
+
+CREATE TABLE IF NOT EXISTS permissions (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id BIGINT NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    permission_id BIGINT NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (role_id, permission_id)
+);
+
+-- Seed permissions
+INSERT INTO permissions (name, description) VALUES ('roles:manage', 'Create roles and change their permissions') ON CONFLICT DO NOTHING;
+INSERT INTO permissions (name, description) VALUES ('users:manage', 'Assign roles to users') ON CONFLICT DO NOTHING;
+
+-- Admins hold every seeded permission
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT 6, id FROM permissions WHERE name IN ('roles:manage', 'users:manage')
+ON CONFLICT DO NOTHING;
+
+-- +goose Down
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS permissions;
@@ -0,0 +1,24 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS login_failures (
+    id BIGSERIAL PRIMARY KEY,
+    email CITEXT NOT NULL,
+    ip_address TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_failures_email_created_at ON login_failures(email, created_at);
+CREATE INDEX IF NOT EXISTS idx_login_failures_ip_created_at ON login_failures(ip_address, created_at);
+
+-- Lockouts are keyed by email rather than user id so that unknown addresses
+-- are throttled exactly like registered ones.
+CREATE TABLE IF NOT EXISTS account_lockouts (
+    email CITEXT PRIMARY KEY,
+    locked_until TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS account_lockouts;
+DROP INDEX IF EXISTS idx_login_failures_ip_created_at;
+DROP INDEX IF EXISTS idx_login_failures_email_created_at;
+DROP TABLE IF EXISTS login_failures;
@@ -0,0 +1,24 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS phone_otps (
+    id BIGSERIAL PRIMARY KEY,
+    phone TEXT NOT NULL,
+    user_id BIGINT REFERENCES users(id) ON DELETE CASCADE,
+    code_hash BYTEA NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    ip_address TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_phone_otps_phone_created_at ON phone_otps(phone, created_at);
+CREATE INDEX IF NOT EXISTS idx_phone_otps_ip_created_at ON phone_otps(ip_address, created_at);
+
+UPDATE users SET phone = NULL WHERE phone = '';
+CREATE INDEX IF NOT EXISTS idx_users_phone ON users(phone);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_users_phone;
+DROP INDEX IF EXISTS idx_phone_otps_ip_created_at;
+DROP INDEX IF EXISTS idx_phone_otps_phone_created_at;
+DROP TABLE IF EXISTS phone_otps;
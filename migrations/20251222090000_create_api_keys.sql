@@ -0,0 +1,38 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS organisations (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    kind TEXT NOT NULL CHECK (kind IN ('lab', 'pharmacy', 'insurance')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Only the prefix and a SHA-256 hash of each key are stored; the full key
+-- is shown once, when it is created.
+CREATE TABLE IF NOT EXISTS api_keys (
+    id BIGSERIAL PRIMARY KEY,
+    organisation_id BIGINT NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL UNIQUE,
+    key_hash BYTEA NOT NULL UNIQUE,
+    scopes TEXT NOT NULL DEFAULT '',
+    created_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_used_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_organisation_id ON api_keys(organisation_id);
+
+-- Seed permissions
+INSERT INTO permissions (name, description) VALUES ('organisations:manage', 'Create partner organisations and manage their API keys') ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT 6, id FROM permissions WHERE name = 'organisations:manage'
+ON CONFLICT DO NOTHING;
+
+-- +goose Down
+DELETE FROM permissions WHERE name = 'organisations:manage';
+DROP INDEX IF EXISTS idx_api_keys_organisation_id;
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS organisations;
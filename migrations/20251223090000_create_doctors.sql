@@ -0,0 +1,29 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS doctors (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    specialization TEXT NOT NULL,
+    years_of_experience INT NOT NULL CHECK (years_of_experience >= 0),
+    bio TEXT NOT NULL DEFAULT '',
+    profile_image TEXT NOT NULL DEFAULT '',
+    licence_number TEXT NOT NULL UNIQUE,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected')),
+    rejection_reason TEXT,
+    reviewed_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    reviewed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_doctors_status ON doctors(status);
+
+-- Seed permissions
+INSERT INTO permissions (name, description) VALUES ('doctors:review', 'Approve or reject doctor applications') ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT 6, id FROM permissions WHERE name = 'doctors:review'
+ON CONFLICT DO NOTHING;
+
+-- +goose Down
+DELETE FROM permissions WHERE name = 'doctors:review';
+DROP INDEX IF EXISTS idx_doctors_status;
+DROP TABLE IF EXISTS doctors;
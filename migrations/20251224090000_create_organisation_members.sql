@@ -0,0 +1,28 @@
+-- +goose Up
+-- A staff account belongs to exactly one organisation.
+CREATE TABLE IF NOT EXISTS organisation_members (
+    organisation_id BIGINT NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    is_admin BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (organisation_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS organisation_invitations (
+    id BIGSERIAL PRIMARY KEY,
+    organisation_id BIGINT NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+    email CITEXT NOT NULL,
+    is_admin BOOLEAN NOT NULL DEFAULT FALSE,
+    token_hash BYTEA NOT NULL UNIQUE,
+    invited_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    accepted_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_organisation_invitations_organisation_id ON organisation_invitations(organisation_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_organisation_invitations_organisation_id;
+DROP TABLE IF EXISTS organisation_invitations;
+DROP TABLE IF EXISTS organisation_members;
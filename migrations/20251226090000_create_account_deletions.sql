@@ -0,0 +1,36 @@
+-- +goose Up
+-- Accounts are anonymised rather than deleted so that records which must be
+-- retained by law keep pointing at a row, so neither users nor their roles
+-- may be removed out from under them.
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_id_fkey;
+ALTER TABLE users
+    ADD CONSTRAINT users_role_id_fkey
+    FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE RESTRICT;
+
+CREATE TABLE IF NOT EXISTS account_deletions (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE RESTRICT,
+    requested_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    scheduled_for TIMESTAMPTZ NOT NULL,
+    cancelled_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+    certificate_id TEXT UNIQUE
+);
+
+-- A user has at most one deletion pending at a time
+CREATE UNIQUE INDEX IF NOT EXISTS idx_account_deletions_pending_user_id
+    ON account_deletions(user_id)
+    WHERE cancelled_at IS NULL AND completed_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_account_deletions_scheduled_for
+    ON account_deletions(scheduled_for)
+    WHERE cancelled_at IS NULL AND completed_at IS NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_account_deletions_scheduled_for;
+DROP INDEX IF EXISTS idx_account_deletions_pending_user_id;
+DROP TABLE IF EXISTS account_deletions;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_id_fkey;
+ALTER TABLE users
+    ADD CONSTRAINT users_role_id_fkey
+    FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE SET NULL;
@@ -0,0 +1,26 @@
+-- +goose Up
+-- Archives are small JSON bundles, so they are kept in the database until
+-- they expire rather than on any one server's disk.
+CREATE TABLE IF NOT EXISTS data_exports (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'ready', 'failed', 'expired')),
+    archive BYTEA,
+    download_token_hash BYTEA UNIQUE,
+    download_expires_at TIMESTAMPTZ,
+    requested_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    completed_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_data_exports_user_id ON data_exports(user_id);
+
+-- A user has at most one export being prepared at a time
+CREATE UNIQUE INDEX IF NOT EXISTS idx_data_exports_pending_user_id
+    ON data_exports(user_id)
+    WHERE status = 'pending';
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_data_exports_pending_user_id;
+DROP INDEX IF EXISTS idx_data_exports_user_id;
+DROP TABLE IF EXISTS data_exports;
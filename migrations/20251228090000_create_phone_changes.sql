@@ -0,0 +1,25 @@
+-- +goose Up
+-- Only numbers confirmed with a texted code can be used to sign in. Numbers
+-- given before this migration were never confirmed, so they start out
+-- unverified.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS phone_verified_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS phone_changes (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    new_phone TEXT NOT NULL,
+    code_hash BYTEA NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_phone_changes_user_id ON phone_changes(user_id);
+CREATE INDEX IF NOT EXISTS idx_phone_changes_new_phone_created_at ON phone_changes(new_phone, created_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_phone_changes_new_phone_created_at;
+DROP INDEX IF EXISTS idx_phone_changes_user_id;
+DROP TABLE IF EXISTS phone_changes;
+ALTER TABLE users DROP COLUMN IF EXISTS phone_verified_at;
@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS magic_link_requests (
+    id BIGSERIAL PRIMARY KEY,
+    email TEXT NOT NULL,
+    ip_address TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_magic_link_requests_email_created_at ON magic_link_requests(email, created_at);
+CREATE INDEX IF NOT EXISTS idx_magic_link_requests_ip_created_at ON magic_link_requests(ip_address, created_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_magic_link_requests_ip_created_at;
+DROP INDEX IF EXISTS idx_magic_link_requests_email_created_at;
+DROP TABLE IF EXISTS magic_link_requests;